@@ -0,0 +1,49 @@
+// Command repair recomputes department paths from parent ids and rewrites
+// the inconsistent ones, with -dry-run it only reports them.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/dimashiro/test_mediasoft/config"
+	"github.com/dimashiro/test_mediasoft/internal/identity"
+	"github.com/dimashiro/test_mediasoft/internal/repository/department"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// actor of audit events written by repair
+const actor = "repair"
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report inconsistent paths without saving")
+	flag.Parse()
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := identity.WithActor(context.Background(), actor)
+	pool, err := pgxpool.Connect(ctx, cfg.GetDBConnString())
+	if err != nil {
+		log.Fatalf("can't create pg pool: %s", err.Error())
+	}
+	defer pool.Close()
+
+	res, err := department.New(pool).RepairPaths(ctx, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range res.Fixed {
+		log.Printf("department %s %q: %s -> %s", f.ID, f.Name, f.Before, f.After)
+	}
+	for _, id := range res.Unreachable {
+		log.Printf("department %s is in a cycle of parents, fix its parent_id manually", id)
+	}
+	if *dryRun {
+		log.Printf("dry run: %d paths to repair", len(res.Fixed))
+		return
+	}
+	log.Printf("%d paths repaired", len(res.Fixed))
+}
@@ -2,14 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/dimashiro/test_mediasoft/config"
+	"github.com/dimashiro/test_mediasoft/internal/auth"
 	"github.com/dimashiro/test_mediasoft/internal/handler"
+	"github.com/dimashiro/test_mediasoft/internal/repository/apikey"
+	"github.com/dimashiro/test_mediasoft/internal/repository/audit"
+	"github.com/dimashiro/test_mediasoft/internal/repository/department"
+	"github.com/dimashiro/test_mediasoft/internal/repository/employee"
+	"github.com/dimashiro/test_mediasoft/internal/repository/grant"
+	"github.com/dimashiro/test_mediasoft/internal/repository/outbox"
+	"github.com/dimashiro/test_mediasoft/internal/repository/schedule"
+	"github.com/dimashiro/test_mediasoft/internal/repository/webhook"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -49,11 +63,46 @@ func run(log *zap.SugaredLogger) error {
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
 	ctx := context.Background()
-	apiRouter, err := handler.NewRouter(ctx, log, cfg)
+	pool, err := pgxpool.Connect(ctx, cfg.GetDBConnString())
+	if err != nil {
+		return fmt.Errorf("can't create pg pool: %s", err.Error())
+	}
+	defer pool.Close()
+
+	uc, err := newUsecases(log, pool, cfg)
+	if err != nil {
+		return err
+	}
+	apiRouter, err := handler.NewRouter(log, uc, handler.Options{WriteTimeout: cfg.WriteTimeout})
 	if err != nil {
 		return fmt.Errorf("can't init router: %s", err.Error())
 	}
 
+	//__________________________________________________________________________
+	// Start workers
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	defer stopWorkers()
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runPeriodically(workerCtx, log, "scheduler", cfg.ScheduleInterval, uc.Schedule.ApplyDue)
+	}()
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runPeriodically(workerCtx, log, "webhooks", cfg.WebhookInterval, uc.Webhook.Dispatch)
+	}()
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		uc.Events.Run(workerCtx)
+	}()
+
 	apiSrv := http.Server{
 		Addr:         cfg.APIHost,
 		Handler:      apiRouter,
@@ -89,6 +138,48 @@ func run(log *zap.SugaredLogger) error {
 	return nil
 }
 
+func newUsecases(log *zap.SugaredLogger, pool *pgxpool.Pool, cfg *config.Config) (handler.Usecases, error) {
+	verifier, err := newVerifier(cfg)
+	if err != nil {
+		return handler.Usecases{}, err
+	}
+	if cfg.AdminAPIKey == "" && !verifier.Enabled() {
+		log.Warnw("start", "status", "neither ADMINAPIKEY nor JWT keys are set, only stored api keys are accepted")
+	}
+
+	rDptm := department.New(pool)
+	rEmpl := employee.New(pool)
+	authz := usecase.NewAuthorizer(log, grant.New(pool))
+	departmentUCase := usecase.NewDepartment(log, rDptm, rEmpl, authz)
+	employeeUCase := usecase.NewEmployee(log, rEmpl, rDptm, authz)
+	authUCase := usecase.NewAuth(log, apikey.New(pool), verifier, cfg.AdminAPIKey)
+
+	return handler.Usecases{
+		Department: departmentUCase,
+		Employee:   employeeUCase,
+		Audit:      usecase.NewAudit(log, audit.New(pool)),
+		Schedule:   usecase.NewSchedule(log, schedule.New(pool), rDptm, rEmpl, departmentUCase, employeeUCase, authz, authUCase),
+		Webhook:    usecase.NewWebhook(log, webhook.New(pool), &http.Client{Timeout: cfg.WebhookTimeout}),
+		Events:     usecase.NewEvents(log, outbox.New(pool)),
+		Auth:       authUCase,
+		Authz:      authz,
+	}, nil
+}
+
+func newVerifier(cfg *config.Config) (*auth.Verifier, error) {
+	var publicKey *rsa.PublicKey
+	if cfg.JWT.PublicKeyFile != "" {
+		data, err := ioutil.ReadFile(cfg.JWT.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read jwt public key: %s", err.Error())
+		}
+		if publicKey, err = auth.ParseRSAPublicKey(data); err != nil {
+			return nil, fmt.Errorf("can't load jwt public key: %s", err.Error())
+		}
+	}
+	return auth.NewVerifier(cfg.JWT.Secret, publicKey, cfg.JWT.Issuer, cfg.JWT.Audience), nil
+}
+
 func initLogger(service string) (*zap.SugaredLogger, error) {
 	config := zap.NewProductionConfig()
 	config.OutputPaths = []string{"stdout"}
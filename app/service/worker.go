@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// runPeriodically runs job every interval until ctx is done, job returns
+// amount of processed items.
+func runPeriodically(ctx context.Context, log *zap.SugaredLogger, name string, interval time.Duration,
+	job func(context.Context) (int, error)) {
+	log.Infow("start", "status", "start "+name, "interval", interval)
+	defer log.Infow("shutdown", "status", name+" stopped")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := job(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Errorw(name, "ERROR", err)
+		}
+		if n > 0 {
+			log.Infow(name, "processed", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -13,7 +13,24 @@ type Config struct {
 	WriteTimeout    time.Duration `env:"WRITETIMEOUT" env-default:"10s"`
 	IdleTimeout     time.Duration `env:"IDLETIMEOUT" env-default:"120s"`
 	ShutdownTimeout time.Duration `env:"SHUTDOWNTIMEOUT" env-default:"20s"`
-	DB              struct {
+	// ScheduleInterval is how often due scheduled changes are applied.
+	ScheduleInterval time.Duration `env:"SCHEDULEINTERVAL" env-default:"30s"`
+	// WebhookInterval is how often outbox events are delivered to webhooks,
+	// WebhookTimeout limits one delivery request.
+	WebhookInterval time.Duration `env:"WEBHOOKINTERVAL" env-default:"5s"`
+	WebhookTimeout  time.Duration `env:"WEBHOOKTIMEOUT" env-default:"10s"`
+	// AdminAPIKey is bootstrap key with admin rights, it isn't stored and
+	// is meant to issue the first api keys.
+	AdminAPIKey string `env:"ADMINAPIKEY"`
+	// JWT bearer tokens are accepted if secret (HS256) or public key file
+	// (RS256, PEM) is set, issuer and audience are checked if set.
+	JWT struct {
+		Secret        string `env:"JWTSECRET"`
+		PublicKeyFile string `env:"JWTPUBLICKEYFILE"`
+		Issuer        string `env:"JWTISSUER"`
+		Audience      string `env:"JWTAUDIENCE"`
+	}
+	DB struct {
 		DBUser         string `env:"DBUSER" env-default:"postgres"`
 		DBPassword     string `env:"DBPASSWORD" env-default:"postgres"`
 		DBHost         string `env:"DBHOST" env-default:"localhost"`
@@ -0,0 +1,142 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+// Code classifies domain errors, handlers map it to http status.
+type Code string
+
+const (
+	CodeBadRequest     Code = "bad_request"
+	CodeValidation     Code = "validation_error"
+	CodeUnauthorized   Code = "unauthorized"
+	CodeForbidden      Code = "forbidden"
+	CodeNotFound       Code = "not_found"
+	CodeConflict       Code = "conflict"
+	CodeHasDescendants Code = "has_descendants"
+	CodeConstraint     Code = "constraint_violation"
+	CodePrecondition   Code = "precondition_failed"
+	CodeInternal       Code = "internal_error"
+)
+
+// postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+	pgInvalidTextRepr     = "22P02"
+)
+
+// Error is a domain error. Message is safe to show to the client,
+// wrapped Err is for logs only.
+type Error struct {
+	Code    Code
+	Message string
+	Details interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func BadRequest(msg string, err error) *Error {
+	return &Error{Code: CodeBadRequest, Message: msg, Err: err}
+}
+
+func Validation(msg string, details interface{}) *Error {
+	return &Error{Code: CodeValidation, Message: msg, Details: details}
+}
+
+// Unauthorized means that caller isn't authenticated.
+func Unauthorized(msg string, err error) *Error {
+	return &Error{Code: CodeUnauthorized, Message: msg, Err: err}
+}
+
+// Forbidden means that authenticated caller isn't allowed to do it.
+func Forbidden(msg string) *Error {
+	return &Error{Code: CodeForbidden, Message: msg}
+}
+
+func NotFound(msg string, err error) *Error {
+	return &Error{Code: CodeNotFound, Message: msg, Err: err}
+}
+
+func Conflict(msg string, err error) *Error {
+	return &Error{Code: CodeConflict, Message: msg, Err: err}
+}
+
+func HasDescendants(msg string) *Error {
+	return &Error{Code: CodeHasDescendants, Message: msg}
+}
+
+func Constraint(msg string, err error) *Error {
+	return &Error{Code: CodeConstraint, Message: msg, Err: err}
+}
+
+func PreconditionFailed(msg string) *Error {
+	return &Error{Code: CodePrecondition, Message: msg}
+}
+
+// CodeOf returns code of domain error in chain or CodeInternal.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
+
+// MessageOf returns message of domain error in chain that is safe to show
+// to the client, internal errors are hidden.
+func MessageOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Message
+	}
+	return "internal error"
+}
+
+// Wrap replaces message of domain error keeping its code,
+// other errors are wrapped as internal ones.
+func Wrap(err error, msg string) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return &Error{Code: e.Code, Message: msg, Details: e.Details, Err: err}
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// FromDB converts pgx errors to domain errors where it is possible.
+func FromDB(err error, msg string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFound(msg, err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgForeignKeyViolation:
+			return Constraint(msg+": referenced by other records", err)
+		case pgNotNullViolation, pgCheckViolation:
+			return Constraint(msg+": constraint violated", err)
+		case pgUniqueViolation:
+			return Conflict(msg+": already exists", err)
+		case pgInvalidTextRepr:
+			return BadRequest(msg+": invalid value", err)
+		}
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
@@ -0,0 +1,188 @@
+// Package auth verifies bearer tokens issued by an external identity
+// provider. Only HS256 and RS256 signed JWTs are accepted.
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// clock skew tolerated in exp and nbf checks
+const leeway = 30 * time.Second
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrAlgorithm = errors.New("unsupported signing algorithm")
+	ErrSignature = errors.New("invalid signature")
+	ErrExpired   = errors.New("token is expired")
+	ErrNotYet    = errors.New("token is not valid yet")
+	ErrClaims    = errors.New("invalid claims")
+)
+
+// Claims are registered claims checked by Verifier and admin flag of caller.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	Admin     bool     `json:"admin"`
+}
+
+// audience is either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var list []string
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		*a = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*a = audience{s}
+	return nil
+}
+
+// Verifier checks JWTs signed by configured keys. Algorithm without key is
+// rejected, so token can't choose a weaker check than configured.
+type Verifier struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	issuer    string
+	audience  string
+}
+
+// NewVerifier returns verifier of HS256 tokens signed with secret and RS256
+// tokens signed by key of publicKey, any of them may be empty. Issuer and
+// audience are checked when they are not empty.
+func NewVerifier(secret string, publicKey *rsa.PublicKey, issuer, audience string) *Verifier {
+	return &Verifier{secret: []byte(secret), publicKey: publicKey, issuer: issuer, audience: audience}
+}
+
+// Enabled reports whether any key is configured.
+func (v *Verifier) Enabled() bool {
+	return v != nil && (len(v.secret) > 0 || v.publicKey != nil)
+}
+
+// Verify checks signature and claims of token at now. Subject and
+// expiration are required.
+func (v *Verifier) Verify(token string, now time.Time) (Claims, error) {
+	claims := Claims{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrMalformed
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch {
+	case header.Alg == HS256 && len(v.secret) > 0:
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return claims, ErrSignature
+		}
+	case header.Alg == RS256 && v.publicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], sig); err != nil {
+			return claims, ErrSignature
+		}
+	default:
+		return claims, ErrAlgorithm
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, err
+	}
+	if claims.Subject == "" {
+		return claims, fmt.Errorf("%w: sub is required", ErrClaims)
+	}
+	if claims.ExpiresAt == nil {
+		return claims, fmt.Errorf("%w: exp is required", ErrClaims)
+	}
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(leeway)) {
+		return claims, ErrExpired
+	}
+	if claims.NotBefore != nil && now.Add(leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return claims, ErrNotYet
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return claims, fmt.Errorf("%w: unexpected iss", ErrClaims)
+	}
+	if v.audience != "" && !contains(claims.Audience, v.audience) {
+		return claims, fmt.Errorf("%w: unexpected aud", ErrClaims)
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformed, err.Error())
+	}
+	return nil
+}
+
+// ParseRSAPublicKey reads PEM encoded PKIX or PKCS #1 RSA public key.
+func ParseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse public key: %s", err.Error())
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not RSA")
+	}
+	return rsaKey, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package apikey_handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const (
+	apiKeysURL = "/api/admin/api-keys"
+	apiKeyURL  = "/api/admin/api-keys/:uuid"
+)
+
+type Handler struct {
+	log   *zap.SugaredLogger
+	uCase *usecase.Auth
+}
+
+func New(log *zap.SugaredLogger, uCase *usecase.Auth) Handler {
+	return Handler{log: log, uCase: uCase}
+}
+
+// Routes describes routes of api keys management, all of them need admin rights.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodPost, Path: apiKeysURL, Summary: "Issue api key, the key is shown only in this response",
+			Handler: h.Create, Request: dto.CreateAPIKey{}, Response: dto.NewAPIKey{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: apiKeysURL, Summary: "List api keys",
+			Handler: h.GetAll, Response: []dto.APIKey{}},
+		{Method: http.MethodDelete, Path: apiKeyURL, Summary: "Revoke api key",
+			Handler: h.Delete, Status: http.StatusNoContent},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
+	req := &dto.CreateAPIKey{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	key, err := h.uCase.CreateAPIKey(r.Context(), req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't create api key: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusCreated, key)
+}
+
+func (h Handler) GetAll(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.uCase.GetAPIKeys(r.Context())
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get api keys: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, keys)
+}
+
+func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	if err := h.uCase.DeleteAPIKey(ctx, params.ByName("uuid")); err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't delete api key: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
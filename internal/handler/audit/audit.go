@@ -0,0 +1,68 @@
+package audit_handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"go.uber.org/zap"
+)
+
+const (
+	auditURL = "/api/audit"
+)
+
+type Handler struct {
+	log   *zap.SugaredLogger
+	uCase *usecase.Audit
+}
+
+func New(log *zap.SugaredLogger, uCase *usecase.Audit) Handler {
+	return Handler{log: log, uCase: uCase}
+}
+
+// Routes describes routes of audit log.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodGet, Path: auditURL, Summary: "Audit log of department and employee changes",
+			Handler: h.GetEvents, Response: []dto.AuditEvent{},
+			Query: []web.QueryParam{web.StringParam("entity"), web.StringParam("id"), web.TimeParam("since"), web.IntParam("limit"), web.IntParam("offset")}},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+func (h Handler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	q := web.NewQuery(r)
+	f := &dto.ListAudit{
+		Entity:   q.String("entity"),
+		EntityID: q.String("id"),
+		Since:    q.Time("since"),
+		Limit:    q.Int("limit"),
+		Offset:   q.Int("offset"),
+	}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := f.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	events, total, err := h.uCase.GetEvents(r.Context(), f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get audit events: %w", err))
+		return
+	}
+
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, events)
+}
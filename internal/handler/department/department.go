@@ -1,11 +1,18 @@
 package department_handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
 	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model"
 	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/orgchart"
 	"github.com/dimashiro/test_mediasoft/internal/usecase"
 	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
@@ -14,11 +21,21 @@ import (
 const (
 	departmentCreateURL          = "/api/department/create"
 	departmentUpdateURL          = "/api/department/update"
+	departmentMoveURL            = "/api/department/move"
 	departmentHierachyURL        = "/api/departments/hierarchy"
+	departmentHierachyDotURL     = "/api/departments/hierarchy.dot"
+	departmentHierachySvgURL     = "/api/departments/hierarchy.svg"
 	departmentsURL               = "/api/departments"
+	departmentsExportURL         = "/api/departments/export"
 	departmentDeleteURL          = "/api/department/delete"
+	departmentURL                = "/api/department/:uuid"
 	emplInDepartmentURL          = "/api/department/:uuid/employees"
 	emplInDepartmentHierarchyURL = "/api/department/:uuid/employees/all"
+	departmentSubtreeURL         = "/api/department/:uuid/hierarchy"
+	departmentAncestorsURL       = "/api/department/:uuid/ancestors"
+
+	v2DepartmentsURL = "/api/v2/departments"
+	v2DepartmentURL  = "/api/v2/departments/:uuid"
 )
 
 type Handler struct {
@@ -30,14 +47,77 @@ func New(log *zap.SugaredLogger, uCase *usecase.Department) Handler {
 	return Handler{log: log, uCase: uCase}
 }
 
-func (h Handler) Register(r *httprouter.Router) {
-	r.HandlerFunc(http.MethodGet, departmentsURL, middleware.Logging(h.log, h.GetAllDepartments))
-	r.HandlerFunc(http.MethodPost, departmentCreateURL, middleware.Logging(h.log, h.Create))
-	r.HandlerFunc(http.MethodPut, departmentUpdateURL, middleware.Logging(h.log, h.Update))
-	r.HandlerFunc(http.MethodGet, departmentHierachyURL, middleware.Logging(h.log, h.Hierarchy))
-	r.HandlerFunc(http.MethodDelete, departmentDeleteURL, middleware.Logging(h.log, h.Delete))
-	r.HandlerFunc(http.MethodGet, emplInDepartmentURL, middleware.Logging(h.log, h.GetEmployees))
-	r.HandlerFunc(http.MethodGet, emplInDepartmentHierarchyURL, middleware.Logging(h.log, h.GetEmployeesInHierarchy))
+var deleteQuery = []web.QueryParam{web.StringParam("strategy"), web.StringParam("target_id"), web.BoolParam("dry_run")}
+
+var chartQuery = []web.QueryParam{web.StringParam("root"), web.BoolParam("employees")}
+
+var hierarchyEmployeesQuery = append(append([]web.QueryParam{}, web.ListEmployeesParams...), web.BoolParam("distinct"))
+
+// Routes describes v1 routes of departments.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodGet, Path: departmentsURL, Summary: "List departments with member counts",
+			Handler: h.GetAllDepartments, Response: []dto.ViewAllDepartments{}, Query: web.ListDepartmentsParams},
+		{Method: http.MethodPost, Path: departmentCreateURL, Summary: "Create department",
+			Handler: h.Create, Request: dto.CreateDepartment{}, Response: model.Department{}, Status: http.StatusCreated},
+		{Method: http.MethodPut, Path: departmentUpdateURL, Summary: "Rename, re-parent or change head of department",
+			Handler: h.Update, Request: dto.UpdateDepartment{}},
+		{Method: http.MethodPut, Path: departmentMoveURL, Summary: "Move department subtree",
+			Handler: h.Move, Request: dto.MoveDepartment{}},
+		{Method: http.MethodGet, Path: departmentHierachyURL, Summary: "Department tree",
+			Handler: h.Hierarchy, Response: []model.Department{}},
+		{Method: http.MethodGet, Path: departmentHierachyDotURL,
+			Summary: "Department tree as Graphviz DOT, optionally of root department and with employees",
+			Handler: h.HierarchyDOT, Response: "", ContentType: "text/vnd.graphviz", Query: chartQuery},
+		{Method: http.MethodGet, Path: departmentHierachySvgURL,
+			Summary: "Department tree as SVG, optionally of root department and with employees",
+			Handler: h.HierarchySVG, Response: "", ContentType: "image/svg+xml", Query: chartQuery},
+		{Method: http.MethodGet, Path: departmentsExportURL,
+			Summary: "Stream all departments with full paths and member counts as csv or json lines",
+			Handler: h.Export, Response: []dto.DepartmentExportRow{}, ContentType: "text/csv", Query: web.ExportParams},
+		{Method: http.MethodDelete, Path: departmentDeleteURL, Summary: "Delete department",
+			Handler: h.Delete, Request: dto.DeleteDepartment{}, Response: dto.DeleteDepartmentResult{}, Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: departmentURL, Summary: "Department with parent, breadcrumbs and children",
+			Handler: h.Get, Response: dto.ViewDepartment{}},
+		{Method: http.MethodGet, Path: emplInDepartmentURL, Summary: "Employees of department",
+			Handler: h.GetEmployees, Response: []model.Employee{}, Query: web.ListEmployeesParams},
+		{Method: http.MethodGet, Path: emplInDepartmentHierarchyURL,
+			Summary: "Employees of department and its descendants, distinct lists each person once with matched departments",
+			Handler: h.GetEmployeesInHierarchy, Response: []model.Employee{}, Query: hierarchyEmployeesQuery},
+		{Method: http.MethodGet, Path: departmentSubtreeURL, Summary: "Department with descendants, depth limits levels below it",
+			Handler: h.Subtree, Response: model.Department{}, Query: []web.QueryParam{web.IntParam("depth")}},
+		{Method: http.MethodGet, Path: departmentAncestorsURL, Summary: "Breadcrumbs from root to department",
+			Handler: h.Ancestors, Response: []dto.DepartmentRef{}},
+	}
+}
+
+// RoutesV2 describes resource oriented routes of api v2.
+func (h Handler) RoutesV2() []web.Route {
+	return []web.Route{
+		{Method: http.MethodGet, Path: v2DepartmentsURL, Summary: "List departments with member counts",
+			Handler: h.GetAllDepartments, Response: []dto.ViewAllDepartments{}, Query: web.ListDepartmentsParams},
+		{Method: http.MethodPost, Path: v2DepartmentsURL, Summary: "Create department",
+			Handler: h.Create, Request: dto.CreateDepartment{}, Response: model.Department{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: v2DepartmentURL, Summary: "Department with parent, breadcrumbs and children",
+			Handler: h.Get, Response: dto.ViewDepartment{}},
+		{Method: http.MethodPatch, Path: v2DepartmentURL, Summary: "Rename, re-parent or change head of department",
+			Handler: h.Patch, Request: dto.UpdateDepartment{}, Response: dto.ViewDepartment{}},
+		{Method: http.MethodDelete, Path: v2DepartmentURL, Summary: "Delete department",
+			Handler: h.DeleteByID, Response: dto.DeleteDepartmentResult{}, Status: http.StatusNoContent, Query: deleteQuery},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+// RegisterV2 registers resource oriented routes of api v2.
+func (h Handler) RegisterV2(r *web.Router) {
+	for _, rt := range h.RoutesV2() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
 }
 
 func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
@@ -47,39 +127,24 @@ func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
 	// parse req body to dto
 	err := json.NewDecoder(r.Body).Decode(&dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
 		return
 	}
 
 	// check that request valid
 	err = h.validateReq(dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, err)
 		return
 	}
 
 	dp, err := h.uCase.CreateDepartment(ctx, dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't create department: "+err.Error())
-		http.Error(w, "can't create department: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't create department: %w", err))
 		return
 	}
 
-	jsonData, err := json.Marshal(dp)
-	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't marshal department: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonData); err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	web.JSON(w, h.log, http.StatusCreated, dp)
 }
 
 func (h Handler) Update(w http.ResponseWriter, r *http.Request) {
@@ -89,23 +154,26 @@ func (h Handler) Update(w http.ResponseWriter, r *http.Request) {
 	// parse req body to dto
 	err := json.NewDecoder(r.Body).Decode(&dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+
+	dto.Version, err = web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
 		return
 	}
 
 	// check that request valid
 	err = h.validateReq(dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, err)
 		return
 	}
 
 	err = h.uCase.UpdateDepartment(ctx, dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't update department: "+err.Error())
-		http.Error(w, "can't create department: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't update department: %w", err))
 		return
 	}
 
@@ -113,48 +181,132 @@ func (h Handler) Update(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(`{"success": "ok"}`)
 }
 
-func (h Handler) Hierarchy(w http.ResponseWriter, r *http.Request) {
-	dps, err := h.uCase.HierarchyDepartment(r.Context())
+func (h Handler) Move(w http.ResponseWriter, r *http.Request) {
+	// prepare dto to parse request
+	ctx := r.Context()
+	dto := &dto.MoveDepartment{}
+	// parse req body to dto
+	err := json.NewDecoder(r.Body).Decode(&dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't get departments: "+err.Error())
-		http.Error(w, "can't get departments: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
 		return
 	}
 
-	jsonData, err := json.Marshal(dps)
+	dto.Version, err = web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	// check that request valid
+	err = h.validateReq(dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't marshal departments: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, err)
 		return
 	}
+
+	err = h.uCase.MoveDepartment(ctx, dto)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't move department: %w", err))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonData); err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(`{"success": "ok"}`)
+}
+
+func (h Handler) HierarchyDOT(w http.ResponseWriter, r *http.Request) {
+	h.chart(w, r, "text/vnd.graphviz; charset=utf-8", orgchart.DOT)
+}
+
+func (h Handler) HierarchySVG(w http.ResponseWriter, r *http.Request) {
+	h.chart(w, r, "image/svg+xml", orgchart.SVG)
+}
+
+// chart renders org chart requested by query with render.
+func (h Handler) chart(w http.ResponseWriter, r *http.Request, contentType string,
+	render func(io.Writer, []*dto.OrgNode) error) {
+	q := web.NewQuery(r)
+	req := &dto.OrgChart{RootID: q.String("root"), WithEmployees: q.Bool("employees")}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := h.validateReq(req); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	nodes, err := h.uCase.OrgChart(r.Context(), req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't build org chart: %w", err))
+		return
+	}
+
+	// chart is rendered first, so an error still gets its status
+	var buf bytes.Buffer
+	if err := render(&buf, nodes); err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't render org chart: %w", err))
 		return
 	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		h.log.Errorw("ERROR", "ERROR", "can't write org chart: "+err.Error())
+	}
 }
 
-func (h Handler) GetAllDepartments(w http.ResponseWriter, r *http.Request) {
-	dps, err := h.uCase.GetAllDepartments(r.Context())
+// Export streams departments, an error in the middle of the stream can
+// only be logged as the status is already sent.
+func (h Handler) Export(w http.ResponseWriter, r *http.Request) {
+	format, err := web.ExportFormat(r)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't get departments: "+err.Error())
-		http.Error(w, "can't get departments: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, err)
 		return
 	}
+	rw, err := web.NewRowWriter(w, format, "departments", dto.DepartmentExportColumns)
+	if err == nil {
+		err = h.uCase.ExportDepartments(r.Context(), func(d dto.DepartmentExportRow) error {
+			return rw.Write(d)
+		})
+	}
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		rw.Error(h.log, fmt.Errorf("can't export departments after %d rows: %w", rw.Rows(), err))
+	}
+}
 
-	jsonData, err := json.Marshal(dps)
+func (h Handler) Hierarchy(w http.ResponseWriter, r *http.Request) {
+	dps, err := h.uCase.HierarchyDepartment(r.Context())
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't marshal departments: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't get departments: %w", err))
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonData); err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+
+	web.JSON(w, h.log, http.StatusOK, dps)
+}
+
+func (h Handler) GetAllDepartments(w http.ResponseWriter, r *http.Request) {
+	f, err := web.ListDepartments(r)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := h.validateReq(f); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	dps, total, err := h.uCase.GetAllDepartments(r.Context(), f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get departments: %w", err))
 		return
 	}
+
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, dps)
 }
 
 func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -164,23 +316,32 @@ func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	// parse req body to dto
 	err := json.NewDecoder(r.Body).Decode(&dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+
+	dto.Version, err = web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
 		return
 	}
 
 	// check that request valid
 	err = h.validateReq(dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, err)
 		return
 	}
 
-	err = h.uCase.DeleteDepartment(ctx, dto)
+	res, err := h.uCase.DeleteDepartment(ctx, dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't delete department: "+err.Error())
-		http.Error(w, "can't delete department: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't delete department: %w", err))
+		return
+	}
+
+	// dry run reports planned changes instead of empty response
+	if res.DryRun {
+		web.JSON(w, h.log, http.StatusOK, res)
 		return
 	}
 
@@ -189,33 +350,168 @@ func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(`{"success": "ok"}`)
 }
 
+func (h Handler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	dpUUID := params.ByName("uuid")
+	if dpUUID == "" {
+		web.Error(w, h.log, apperror.BadRequest("wrong uuid in req", nil))
+		return
+	}
+	dp, err := h.uCase.GetDepartment(ctx, dpUUID)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get department: %w", err))
+		return
+	}
+
+	web.SetETag(w, dp.Version)
+	web.JSON(w, h.log, http.StatusOK, dp)
+}
+
+// Patch updates department taken from url and returns its new state.
+func (h Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	dto := &dto.UpdateDepartment{}
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+	dto.ID = params.ByName("uuid")
+
+	dto.Version, err = web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	// check that request valid
+	err = h.validateReq(dto)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	err = h.uCase.UpdateDepartment(ctx, dto)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't update department: %w", err))
+		return
+	}
+
+	dp, err := h.uCase.GetDepartment(ctx, dto.ID)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get department: %w", err))
+		return
+	}
+
+	web.SetETag(w, dp.Version)
+	web.JSON(w, h.log, http.StatusOK, dp)
+}
+
+// DeleteByID deletes department taken from url, strategy is read from query.
+func (h Handler) DeleteByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	q := web.NewQuery(r)
+	dto := &dto.DeleteDepartment{
+		ID:       params.ByName("uuid"),
+		Strategy: q.String("strategy"),
+		TargetID: q.String("target_id"),
+		DryRun:   q.Bool("dry_run"),
+	}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	version, err := web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	dto.Version = version
+
+	// check that request valid
+	err = h.validateReq(dto)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	res, err := h.uCase.DeleteDepartment(ctx, dto)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't delete department: %w", err))
+		return
+	}
+
+	if res.DryRun {
+		web.JSON(w, h.log, http.StatusOK, res)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h Handler) Subtree(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	q := web.NewQuery(r)
+	req := &dto.SubtreeDepartment{ID: params.ByName("uuid"), Depth: q.Int("depth")}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := h.validateReq(req); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	dp, err := h.uCase.GetSubtree(ctx, req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get subtree: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, dp)
+}
+
+func (h Handler) Ancestors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	refs, err := h.uCase.GetAncestors(ctx, params.ByName("uuid"))
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get ancestors: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, refs)
+}
+
 func (h Handler) GetEmployees(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
 	emplUUID := params.ByName("uuid")
 	if emplUUID == "" {
-		h.log.Errorw("ERROR", "ERROR", "wrong uuid in req")
-		http.Error(w, "bad request", http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("wrong uuid in req", nil))
+		return
 	}
-	empls, err := h.uCase.GetEmployeesByDepartment(ctx, emplUUID)
+	f, err := web.ListEmployees(r)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't get employees: "+err.Error())
-		http.Error(w, "can't get employees: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, err)
 		return
 	}
-
-	jsonData, err := json.Marshal(empls)
-	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't marshal employees: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+	if err := h.validateReq(f); err != nil {
+		web.Error(w, h.log, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonData); err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+	empls, total, err := h.uCase.GetEmployeesByDepartment(ctx, emplUUID, f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get employees: %w", err))
 		return
 	}
+
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, empls)
 }
 
 func (h Handler) GetEmployeesInHierarchy(w http.ResponseWriter, r *http.Request) {
@@ -223,31 +519,37 @@ func (h Handler) GetEmployeesInHierarchy(w http.ResponseWriter, r *http.Request)
 	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
 	dpUUID := params.ByName("uuid")
 	if dpUUID == "" {
-		h.log.Errorw("ERROR", "ERROR", "wrong uuid in req")
-		http.Error(w, "bad request", http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("wrong uuid in req", nil))
+		return
 	}
-	empls, err := h.uCase.GetEmployeesInDepartmentHierarchy(ctx, dpUUID)
+	f, err := web.ListEmployees(r)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't get employees: "+err.Error())
-		http.Error(w, "can't get employees: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, err)
 		return
 	}
-
-	jsonData, err := json.Marshal(empls)
-	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't marshal employees: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+	q := web.NewQuery(r)
+	f.Distinct = q.Bool("distinct")
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonData); err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+	if err := h.validateReq(f); err != nil {
+		web.Error(w, h.log, err)
 		return
 	}
+	empls, total, err := h.uCase.GetEmployeesInDepartmentHierarchy(ctx, dpUUID, f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get employees: %w", err))
+		return
+	}
+
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, empls)
 }
 
-func (h Handler) validateReq(dto interface{}) error {
-	//TODO add validation
+func (h Handler) validateReq(req interface{}) error {
+	if v, ok := req.(dto.Validator); ok {
+		return v.Validate()
+	}
 	return nil
 }
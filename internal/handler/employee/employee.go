@@ -1,10 +1,18 @@
 package employee_handler
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
 	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model"
 	"github.com/dimashiro/test_mediasoft/internal/model/dto"
 	"github.com/dimashiro/test_mediasoft/internal/usecase"
 	"github.com/julienschmidt/httprouter"
@@ -12,12 +20,30 @@ import (
 )
 
 const (
-	employeeCreateURL = "/api/employees/create"
-	employeeUpdateURL = "/api/employees/update"
-	employeesURL      = "/api/employees"
-	employeeDeleteURL = "/api/employees/delete"
+	employeeCreateURL   = "/api/employees/create"
+	employeeUpdateURL   = "/api/employees/update"
+	employeesURL        = "/api/employees"
+	employeeDeleteURL   = "/api/employees/delete"
+	employeeURL         = "/api/employees/:uuid"
+	employeeSearchURL   = "/api/employees/search"
+	employeeTimelineURL = "/api/employees/:uuid/timeline"
+	employeeImportURL   = "/api/employees/import"
+	employeeExportURL   = "/api/employees/export"
+	employeeManagersURL = "/api/employees/:uuid/managers"
+	employeeReportsURL  = "/api/employees/:uuid/reports"
+	employeeTreeURL     = "/api/employees/:uuid/reports/tree"
+
+	v2EmployeesURL = "/api/v2/employees"
+	v2EmployeeURL  = "/api/v2/employees/:uuid"
+	v2TimelineURL  = "/api/v2/employees/:uuid/timeline"
+	v2ManagersURL  = "/api/v2/employees/:uuid/managers"
+	v2ReportsURL   = "/api/v2/employees/:uuid/reports"
+	v2TreeURL      = "/api/v2/employees/:uuid/reports/tree"
 )
 
+// maxImportSize limits size of imported csv file.
+const maxImportSize = 5 << 20
+
 type Handler struct {
 	log   *zap.SugaredLogger
 	uCase *usecase.Employee
@@ -27,11 +53,81 @@ func New(log *zap.SugaredLogger, uCase *usecase.Employee) Handler {
 	return Handler{log: log, uCase: uCase}
 }
 
-func (h Handler) Register(r *httprouter.Router) {
-	r.HandlerFunc(http.MethodPost, employeeCreateURL, middleware.Logging(h.log, h.Create))
-	r.HandlerFunc(http.MethodGet, employeesURL, middleware.Logging(h.log, h.GetAll))
-	r.HandlerFunc(http.MethodPut, employeeUpdateURL, middleware.Logging(h.log, h.Update))
-	r.HandlerFunc(http.MethodDelete, employeeDeleteURL, middleware.Logging(h.log, h.Delete))
+// Routes describes v1 routes of employees.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodPost, Path: employeeCreateURL, Summary: "Create employee",
+			Handler: h.Create, Request: dto.CreateEmployee{}, Response: model.Employee{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: employeesURL, Summary: "List employees with departments",
+			Handler: h.GetAll, Response: []model.Employee{}, Query: web.ListEmployeesParams},
+		{Method: http.MethodPut, Path: employeeUpdateURL, Summary: "Update employee",
+			Handler: h.Update, Request: dto.UpdateEmployee{}},
+		{Method: http.MethodDelete, Path: employeeDeleteURL, Summary: "Delete employee",
+			Handler: h.Delete, Request: dto.DeleteEmployee{}, Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: employeeURL, Summary: "Employee with departments and their full paths",
+			Handler: h.getByIDOrAction, Response: dto.ViewEmployee{}},
+		{Method: http.MethodGet, Path: employeeSearchURL, Summary: "Fuzzy search of employees by name and surname",
+			Response: []dto.EmployeeSearchResult{}, Query: []web.QueryParam{web.StringParam("q"), web.StringParam("department_id"), web.IntParam("limit")}},
+		{Method: http.MethodGet, Path: employeeExportURL,
+			Summary:  "Stream all employees with full paths of departments as csv or json lines",
+			Response: []dto.EmployeeExportRow{}, ContentType: "text/csv", Query: web.ExportParams},
+		{Method: http.MethodGet, Path: employeeTimelineURL, Summary: "Department memberships of employee over time",
+			Handler: h.Timeline, Response: []dto.MembershipPeriod{}},
+		{Method: http.MethodGet, Path: employeeManagersURL, Summary: "Managers of employee from the direct one up",
+			Handler: h.Managers, Response: []dto.EmployeeRef{}},
+		{Method: http.MethodGet, Path: employeeReportsURL, Summary: "Direct reports of employee",
+			Handler: h.Reports, Response: []dto.EmployeeRef{}},
+		{Method: http.MethodGet, Path: employeeTreeURL,
+			Summary: "Everyone reporting to employee, depth limits levels below it",
+			Handler: h.ReportingTree, Response: dto.ReportingNode{}, Query: []web.QueryParam{web.IntParam("depth")}},
+		{Method: http.MethodPost, Path: employeeImportURL,
+			Summary: "Import employees from csv with columns " + strings.Join(dto.ImportColumns, ", ") +
+				", departments are ids or paths like Software / Web separated by ;",
+			Handler: h.Import, Request: "", RequestContentType: "text/csv",
+			Response: dto.ImportEmployeesResult{}, Status: http.StatusCreated, Query: []web.QueryParam{web.BoolParam("dry_run")}},
+	}
+}
+
+// RoutesV2 describes resource oriented routes of api v2.
+func (h Handler) RoutesV2() []web.Route {
+	return []web.Route{
+		{Method: http.MethodGet, Path: v2EmployeesURL, Summary: "List employees with departments",
+			Handler: h.GetAll, Response: []model.Employee{}, Query: web.ListEmployeesParams},
+		{Method: http.MethodPost, Path: v2EmployeesURL, Summary: "Create employee",
+			Handler: h.Create, Request: dto.CreateEmployee{}, Response: model.Employee{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: v2EmployeeURL, Summary: "Employee with departments and their full paths",
+			Handler: h.Get, Response: dto.ViewEmployee{}},
+		{Method: http.MethodPatch, Path: v2EmployeeURL, Summary: "Update employee",
+			Handler: h.Patch, Request: dto.UpdateEmployee{}, Response: dto.ViewEmployee{}},
+		{Method: http.MethodDelete, Path: v2EmployeeURL, Summary: "Delete employee",
+			Handler: h.DeleteByID, Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: v2TimelineURL, Summary: "Department memberships of employee over time",
+			Handler: h.Timeline, Response: []dto.MembershipPeriod{}},
+		{Method: http.MethodGet, Path: v2ManagersURL, Summary: "Managers of employee from the direct one up",
+			Handler: h.Managers, Response: []dto.EmployeeRef{}},
+		{Method: http.MethodGet, Path: v2ReportsURL, Summary: "Direct reports of employee",
+			Handler: h.Reports, Response: []dto.EmployeeRef{}},
+		{Method: http.MethodGet, Path: v2TreeURL,
+			Summary: "Everyone reporting to employee, depth limits levels below it",
+			Handler: h.ReportingTree, Response: dto.ReportingNode{}, Query: []web.QueryParam{web.IntParam("depth")}},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		// routes without handler are served by dispatchers
+		if rt.Handler == nil {
+			continue
+		}
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+// RegisterV2 registers resource oriented routes of api v2.
+func (h Handler) RegisterV2(r *web.Router) {
+	for _, rt := range h.RoutesV2() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
 }
 
 func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
@@ -41,62 +137,280 @@ func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
 	// parse req body to dto
 	err := json.NewDecoder(r.Body).Decode(&dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
 		return
 	}
 
 	// check that request valid
 	err = h.validateReq(dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, err)
 		return
 	}
 
 	empl, err := h.uCase.CreateEmployee(ctx, dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't create employee: "+err.Error())
-		http.Error(w, "can't create employee: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't create employee: %w", err))
 		return
 	}
 
-	jsonData, err := json.Marshal(empl)
+	web.JSON(w, h.log, http.StatusCreated, empl)
+}
+
+// Export streams employees, an error in the middle of the stream can only
+// be logged as the status is already sent.
+func (h Handler) Export(w http.ResponseWriter, r *http.Request) {
+	format, err := web.ExportFormat(r)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't marshal employee: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonData); err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+	rw, err := web.NewRowWriter(w, format, "employees", dto.EmployeeExportColumns)
+	if err == nil {
+		err = h.uCase.ExportEmployees(r.Context(), func(e dto.EmployeeExportRow) error {
+			return rw.Write(e)
+		})
+	}
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		rw.Error(h.log, fmt.Errorf("can't export employees after %d rows: %w", rw.Rows(), err))
+	}
+}
+
+// Import creates employees from csv all at once, dry run reports them
+// without saving.
+func (h Handler) Import(w http.ResponseWriter, r *http.Request) {
+	q := web.NewQuery(r)
+	req := &dto.ImportEmployees{DryRun: q.Bool("dry_run")}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	rows, err := readImportCSV(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	req.Rows = rows
+	if err := h.validateReq(req); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	res, err := h.uCase.ImportEmployees(r.Context(), req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't import employees: %w", err))
 		return
 	}
+
+	status := http.StatusCreated
+	if res.DryRun {
+		status = http.StatusOK
+	}
+	web.JSON(w, h.log, status, res)
+}
+
+// readImportCSV reads rows of csv with header, columns may go in any order.
+func readImportCSV(body io.Reader) ([]dto.ImportEmployeeRow, error) {
+	rows := []dto.ImportEmployeeRow{}
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return rows, apperror.BadRequest("empty csv", err)
+		}
+		return rows, apperror.BadRequest("bad csv", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range dto.ImportColumns {
+		if _, ok := columns[name]; !ok {
+			return rows, apperror.BadRequest("csv header must contain columns "+
+				strings.Join(dto.ImportColumns, ", ")+", missing "+name, nil)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, apperror.BadRequest("bad csv", err)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := dto.ImportEmployeeRow{
+			Line:      line,
+			Name:      field("name"),
+			Surname:   field("surname"),
+			BirthYear: field("birthyear"),
+		}
+		for _, dp := range strings.Split(field("departments"), ";") {
+			if dp = strings.TrimSpace(dp); dp != "" {
+				row.Departments = append(row.Departments, dp)
+			}
+		}
+		rows = append(rows, row)
+	}
 }
 
 func (h Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	empls, err := h.uCase.GetAllEmployees(ctx)
+	f, err := web.ListEmployees(r)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := h.validateReq(f); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	empls, total, err := h.uCase.GetAllEmployees(ctx, f)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't get employees: "+err.Error())
-		http.Error(w, "can't get employees: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't get employees: %w", err))
 		return
 	}
 
-	jsonData, err := json.Marshal(empls)
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, empls)
+}
+
+// getByIDOrAction serves GET /api/employees/{uuid|action}. httprouter
+// doesn't allow static segments next to named ones, so static actions
+// like /api/employees/search are dispatched here.
+func (h Handler) getByIDOrAction(w http.ResponseWriter, r *http.Request) {
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	switch params.ByName("uuid") {
+	case "search":
+		h.Search(w, r)
+	case "export":
+		h.Export(w, r)
+	default:
+		h.Get(w, r)
+	}
+}
+
+func (h Handler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	emplUUID := params.ByName("uuid")
+	if emplUUID == "" {
+		web.Error(w, h.log, apperror.BadRequest("wrong uuid in req", nil))
+		return
+	}
+	empl, err := h.uCase.GetEmployee(ctx, emplUUID)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't marshal employees: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't get employee: %w", err))
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonData); err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
-		http.Error(w, "unexpected error: "+err.Error(), http.StatusInternalServerError)
+
+	web.SetETag(w, empl.Version)
+	web.JSON(w, h.log, http.StatusOK, empl)
+}
+
+func (h Handler) Timeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	emplUUID := params.ByName("uuid")
+	if emplUUID == "" {
+		web.Error(w, h.log, apperror.BadRequest("wrong uuid in req", nil))
+		return
+	}
+	periods, err := h.uCase.GetEmployeeTimeline(ctx, emplUUID)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get employee timeline: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, periods)
+}
+
+// Managers returns management chain of employee, manager of manager is the
+// second one.
+func (h Handler) Managers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	refs, err := h.uCase.GetManagers(ctx, params.ByName("uuid"))
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get managers: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, refs)
+}
+
+func (h Handler) Reports(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	refs, err := h.uCase.GetReports(ctx, params.ByName("uuid"))
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get reports: %w", err))
 		return
 	}
+
+	web.JSON(w, h.log, http.StatusOK, refs)
+}
+
+func (h Handler) ReportingTree(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	q := web.NewQuery(r)
+	req := &dto.ReportingTree{ID: params.ByName("uuid"), Depth: q.Int("depth")}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := h.validateReq(req); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	tree, err := h.uCase.GetReportingTree(ctx, req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get reporting tree: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, tree)
+}
+
+func (h Handler) Search(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := web.NewQuery(r)
+	f := &dto.SearchEmployees{
+		Query:        q.String("q"),
+		DepartmentID: q.String("department_id"),
+		Limit:        q.Int("limit"),
+	}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := h.validateReq(f); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	empls, err := h.uCase.SearchEmployees(ctx, f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't search employees: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, empls)
 }
 
 func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -104,23 +418,26 @@ func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	dto := &dto.DeleteEmployee{}
 	err := json.NewDecoder(r.Body).Decode(&dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+
+	dto.Version, err = web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
 		return
 	}
 
 	// check that request valid
 	err = h.validateReq(dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, err)
 		return
 	}
 
 	err = h.uCase.DeleteEmployee(ctx, dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't delete employee: "+err.Error())
-		http.Error(w, "can't delete employee: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't delete employee: %w", err))
 		return
 	}
 
@@ -129,28 +446,101 @@ func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(`{"success": "ok"}`)
 }
 
+// Patch updates employee taken from url and returns its new state.
+func (h Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	dto := &dto.UpdateEmployee{}
+	err := json.NewDecoder(r.Body).Decode(&dto)
+	if err != nil {
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+	dto.ID = params.ByName("uuid")
+
+	dto.Version, err = web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	// check that request valid
+	err = h.validateReq(dto)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	err = h.uCase.UpdateEmployee(ctx, dto)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't update employee: %w", err))
+		return
+	}
+
+	empl, err := h.uCase.GetEmployee(ctx, dto.ID)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get employee: %w", err))
+		return
+	}
+
+	web.SetETag(w, empl.Version)
+	web.JSON(w, h.log, http.StatusOK, empl)
+}
+
+// DeleteByID deletes employee taken from url.
+func (h Handler) DeleteByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	dto := &dto.DeleteEmployee{ID: params.ByName("uuid")}
+
+	version, err := web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	dto.Version = version
+
+	// check that request valid
+	err = h.validateReq(dto)
+	if err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	err = h.uCase.DeleteEmployee(ctx, dto)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't delete employee: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h Handler) Update(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	dto := &dto.UpdateEmployee{}
 	err := json.NewDecoder(r.Body).Decode(&dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+
+	dto.Version, err = web.IfMatch(r)
+	if err != nil {
+		web.Error(w, h.log, err)
 		return
 	}
 
 	// check that request valid
 	err = h.validateReq(dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't parse req: "+err.Error())
-		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		web.Error(w, h.log, err)
 		return
 	}
 
 	err = h.uCase.UpdateEmployee(ctx, dto)
 	if err != nil {
-		h.log.Errorw("ERROR", "ERROR", "can't update employee: "+err.Error())
-		http.Error(w, "can't create employee: "+err.Error(), http.StatusInternalServerError)
+		web.Error(w, h.log, fmt.Errorf("can't update employee: %w", err))
 		return
 	}
 
@@ -159,7 +549,9 @@ func (h Handler) Update(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(`{"success": "ok"}`)
 }
 
-func (h Handler) validateReq(dto interface{}) error {
-	//TODO add validation
+func (h Handler) validateReq(req interface{}) error {
+	if v, ok := req.(dto.Validator); ok {
+		return v.Validate()
+	}
 	return nil
 }
@@ -0,0 +1,164 @@
+package events_handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"go.uber.org/zap"
+)
+
+const (
+	streamURL = "/api/events/stream"
+)
+
+const (
+	// stream is closed this long before server write timeout
+	streamMargin = 2 * time.Second
+	// comment sent to keep idle connection open through proxies
+	keepAliveInterval = 15 * time.Second
+	// reconnection delay suggested to clients, in milliseconds
+	retryMillis = 1000
+)
+
+type Handler struct {
+	log   *zap.SugaredLogger
+	uCase *usecase.Events
+	// streamFor limits stream duration, clients reconnect with Last-Event-ID
+	streamFor time.Duration
+}
+
+// New returns handler of event stream, writeTimeout is write timeout of the
+// server as stream must end before it.
+func New(log *zap.SugaredLogger, uCase *usecase.Events, writeTimeout time.Duration) Handler {
+	streamFor := writeTimeout - streamMargin
+	if streamFor <= 0 {
+		streamFor = writeTimeout / 2
+	}
+	return Handler{log: log, uCase: uCase, streamFor: streamFor}
+}
+
+// Routes describes routes of change events.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodGet, Path: streamURL,
+			Summary: "Server-sent events of department and employee changes, resumed by Last-Event-ID header or last_event_id",
+			Handler: h.Stream, Response: dto.Event{}, ContentType: "text/event-stream", Query: []web.QueryParam{web.StringParam("last_event_id")}},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+// Stream sends events until client disconnects or stream time is over.
+// Events committed after Last-Event-ID are sent first.
+func (h Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		web.Error(w, h.log, fmt.Errorf("streaming is not supported by response writer"))
+		return
+	}
+
+	// EventSource can't set headers on first connect, so query is accepted too
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var after int64
+	if lastID != "" {
+		var err error
+		after, err = strconv.ParseInt(lastID, 10, 64)
+		if err != nil || after < 0 {
+			web.Error(w, h.log, apperror.BadRequest("wrong last event id", err))
+			return
+		}
+	}
+
+	// subscription starts before replay, so nothing falls in between
+	events, unsubscribe, err := h.uCase.Subscribe(ctx)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't subscribe to events: %w", err))
+		return
+	}
+	defer unsubscribe()
+
+	var replay []dto.Event
+	var more bool
+	if lastID != "" {
+		var err error
+		replay, more, err = h.uCase.Replay(ctx, after)
+		if err != nil {
+			web.Error(w, h.log, fmt.Errorf("can't replay events: %w", err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+
+	replayed := make(map[int64]bool, len(replay))
+	for _, ev := range replay {
+		if err := writeEvent(w, ev); err != nil {
+			h.log.Errorw("ERROR", "ERROR", err.Error())
+			return
+		}
+		replayed[ev.ID] = true
+	}
+	flusher.Flush()
+	// client continues replay from the last sent event
+	if more {
+		return
+	}
+
+	end := time.NewTimer(h.streamFor)
+	defer end.Stop()
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-end.C:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev, ok := <-events:
+			if !ok {
+				// dropped by broadcaster, client resumes from the last event
+				return
+			}
+			// already sent by replay
+			if replayed[ev.ID] {
+				continue
+			}
+			if err := writeEvent(w, ev); err != nil {
+				h.log.Errorw("ERROR", "ERROR", err.Error())
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev dto.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("can't marshal event: %s", err.Error())
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
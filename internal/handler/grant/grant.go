@@ -0,0 +1,107 @@
+package grant_handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const (
+	grantsURL = "/api/grants"
+	grantURL  = "/api/grants/:uuid"
+)
+
+type Handler struct {
+	log   *zap.SugaredLogger
+	uCase *usecase.Authorizer
+}
+
+func New(log *zap.SugaredLogger, uCase *usecase.Authorizer) Handler {
+	return Handler{log: log, uCase: uCase}
+}
+
+// Routes describes routes of role grants.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodPost, Path: grantsURL,
+			Summary: "Grant role on department and its subtree, needs admin role on the department",
+			Handler: h.Create, Request: dto.CreateGrant{}, Response: dto.Grant{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: grantsURL,
+			Summary: "List grants of subject or within subtree of department",
+			Handler: h.GetAll, Response: []dto.Grant{}, Query: []web.QueryParam{web.StringParam("subject"), web.StringParam("department_id"), web.IntParam("limit"), web.IntParam("offset")}},
+		{Method: http.MethodDelete, Path: grantURL, Summary: "Revoke grant",
+			Handler: h.Delete, Status: http.StatusNoContent},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
+	req := &dto.CreateGrant{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	g, err := h.uCase.CreateGrant(r.Context(), req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't create grant: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusCreated, g)
+}
+
+func (h Handler) GetAll(w http.ResponseWriter, r *http.Request) {
+	q := web.NewQuery(r)
+	f := &dto.ListGrants{
+		Subject:      q.String("subject"),
+		DepartmentID: q.String("department_id"),
+		Limit:        q.Int("limit"),
+		Offset:       q.Int("offset"),
+	}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := f.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	grants, total, err := h.uCase.GetGrants(r.Context(), f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get grants: %w", err))
+		return
+	}
+
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, grants)
+}
+
+func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	if err := h.uCase.DeleteGrant(ctx, params.ByName("uuid")); err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't delete grant: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,39 +1,141 @@
 package handler
 
 import (
-	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/dimashiro/test_mediasoft/config"
+	apikey_handler "github.com/dimashiro/test_mediasoft/internal/handler/apikey"
+	audit_handler "github.com/dimashiro/test_mediasoft/internal/handler/audit"
 	department_handler "github.com/dimashiro/test_mediasoft/internal/handler/department"
 	employee_handler "github.com/dimashiro/test_mediasoft/internal/handler/employee"
-	"github.com/dimashiro/test_mediasoft/internal/repository/department"
-	"github.com/dimashiro/test_mediasoft/internal/repository/employee"
+	events_handler "github.com/dimashiro/test_mediasoft/internal/handler/events"
+	grant_handler "github.com/dimashiro/test_mediasoft/internal/handler/grant"
+	"github.com/dimashiro/test_mediasoft/internal/handler/openapi"
+	schedule_handler "github.com/dimashiro/test_mediasoft/internal/handler/schedule"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	webhook_handler "github.com/dimashiro/test_mediasoft/internal/handler/webhook"
+	"github.com/dimashiro/test_mediasoft/internal/middleware"
 	"github.com/dimashiro/test_mediasoft/internal/usecase"
-	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
 )
 
-func NewRouter(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) (*httprouter.Router, error) {
-	router := httprouter.New()
-	router.HandlerFunc(http.MethodGet, "/heartbeat", Heartbeat)
+const (
+	heartbeatURL = "/heartbeat"
+	openapiURL   = "/api/openapi.json"
+	docsURL      = "/api/docs"
+)
+
+// Usecases are shared by all api handlers.
+type Usecases struct {
+	Department *usecase.Department
+	Employee   *usecase.Employee
+	Audit      *usecase.Audit
+	Schedule   *usecase.Schedule
+	Webhook    *usecase.Webhook
+	Events     *usecase.Events
+	Auth       *usecase.Auth
+	Authz      *usecase.Authorizer
+}
 
-	pool, err := pgxpool.Connect(ctx, cfg.GetDBConnString())
+// Options are server settings handlers depend on.
+type Options struct {
+	// WriteTimeout of the server, long responses like event stream end before it.
+	WriteTimeout time.Duration
+}
+
+func NewRouter(log *zap.SugaredLogger, uc Usecases, opts Options) (http.Handler, error) {
+	router, err := newRouter(log, uc, opts)
 	if err != nil {
-		return nil, fmt.Errorf("can't create pg pool: %s", err.Error())
+		return nil, err
+	}
+	return middleware.Auth(log, uc.Auth, publicPaths(), router), nil
+}
+
+// publicRoutes are served without authentication, browsers load docs
+// without keys.
+var publicRoutes = []web.Route{
+	{Method: http.MethodGet, Path: heartbeatURL, Summary: "Liveness probe", Status: http.StatusNoContent, Public: true},
+	{Method: http.MethodGet, Path: openapiURL, Summary: "OpenAPI specification", Public: true},
+	{Method: http.MethodGet, Path: docsURL, Summary: "Swagger UI", Public: true},
+	{Method: http.MethodGet, Path: docsURL + "/swagger-ui.css", Summary: "Swagger UI stylesheet",
+		Response: "", ContentType: "text/css", Public: true},
+	{Method: http.MethodGet, Path: docsURL + "/swagger-ui-bundle.js", Summary: "Swagger UI script",
+		Response: "", ContentType: "text/javascript", Public: true},
+}
+
+func publicPaths() map[string]bool {
+	paths := make(map[string]bool, len(publicRoutes))
+	for _, rt := range publicRoutes {
+		paths[rt.Path] = true
+	}
+	return paths
+}
+
+// newRouter registers all routes and checks that each of them is documented.
+func newRouter(log *zap.SugaredLogger, uc Usecases, opts Options) (*web.Router, error) {
+	router, spec := buildRouter(log, uc, opts)
+
+	// every registered route must be present in the spec
+	if missing := spec.Missing(router.Registered()); len(missing) > 0 {
+		return nil, fmt.Errorf("routes missing in openapi spec: %s", strings.Join(missing, ", "))
 	}
-	rDptm := department.New(pool)
-	rEmpl := employee.New(pool)
-	departmentUCase := usecase.NewDepartment(log, rDptm, rEmpl)
-	employeeUCase := usecase.NewEmployee(log, rEmpl, rDptm)
 
-	employee_handler.New(log, employeeUCase).Register(router)
-	department_handler.New(log, departmentUCase).Register(router)
 	return router, nil
 }
 
+// buildRouter registers all routes and returns them with their specification.
+func buildRouter(log *zap.SugaredLogger, uc Usecases, opts Options) (*web.Router, *openapi.Document) {
+	router := web.NewRouter()
+	router.HandlerFunc(http.MethodGet, heartbeatURL, Heartbeat)
+
+	employeeHandler := employee_handler.New(log, uc.Employee)
+	departmentHandler := department_handler.New(log, uc.Department)
+	auditHandler := audit_handler.New(log, uc.Audit)
+	scheduleHandler := schedule_handler.New(log, uc.Schedule)
+	webhookHandler := webhook_handler.New(log, uc.Webhook)
+	eventsHandler := events_handler.New(log, uc.Events, opts.WriteTimeout)
+	apiKeyHandler := apikey_handler.New(log, uc.Auth)
+	grantHandler := grant_handler.New(log, uc.Authz)
+
+	// v1 routes are kept as is for existing integrations
+	employeeHandler.Register(router)
+	departmentHandler.Register(router)
+
+	// v2 routes share usecases with v1
+	employeeHandler.RegisterV2(router)
+	departmentHandler.RegisterV2(router)
+
+	auditHandler.Register(router)
+	scheduleHandler.Register(router)
+	webhookHandler.Register(router)
+	eventsHandler.Register(router)
+	apiKeyHandler.Register(router)
+	grantHandler.Register(router)
+
+	// api documentation
+	routes := append([]web.Route{}, publicRoutes...)
+	routes = append(routes, employeeHandler.Routes()...)
+	routes = append(routes, departmentHandler.Routes()...)
+	routes = append(routes, employeeHandler.RoutesV2()...)
+	routes = append(routes, departmentHandler.RoutesV2()...)
+	routes = append(routes, auditHandler.Routes()...)
+	routes = append(routes, scheduleHandler.Routes()...)
+	routes = append(routes, webhookHandler.Routes()...)
+	routes = append(routes, eventsHandler.Routes()...)
+	routes = append(routes, apiKeyHandler.Routes()...)
+	routes = append(routes, grantHandler.Routes()...)
+	spec := openapi.Build("Group management API", "2.0", routes)
+	router.HandlerFunc(http.MethodGet, openapiURL, spec.Handler())
+	router.HandlerFunc(http.MethodGet, docsURL, openapi.UIHandler(log, openapiURL, docsURL))
+	for _, name := range openapi.UIAssets {
+		router.HandlerFunc(http.MethodGet, docsURL+"/"+name, openapi.AssetHandler(name))
+	}
+
+	return router, spec
+}
+
 func Heartbeat(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(204)
 }
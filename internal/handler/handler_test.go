@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	router, spec := buildRouter(zap.NewNop().Sugar(), Usecases{}, Options{})
+	if len(router.Registered()) == 0 {
+		t.Fatal("no routes registered")
+	}
+	if missing := spec.Missing(router.Registered()); len(missing) > 0 {
+		t.Errorf("routes missing in openapi spec: %s", strings.Join(missing, ", "))
+	}
+}
+
+func TestDocsServedLocally(t *testing.T) {
+	router, _ := buildRouter(zap.NewNop().Sugar(), Usecases{}, Options{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, docsURL, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("docs status = %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "https://") {
+		t.Errorf("docs page loads external resources:\n%s", w.Body.String())
+	}
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{docsURL + "/swagger-ui.css", "text/css"},
+		{docsURL + "/swagger-ui-bundle.js", "javascript"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s status = %d", tt.path, w.Code)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+			t.Errorf("%s content type = %q, want %s", tt.path, ct, tt.contentType)
+		}
+		if w.Body.Len() == 0 {
+			t.Errorf("%s is empty", tt.path)
+		}
+	}
+}
+
+func TestSpecTypes(t *testing.T) {
+	_, spec := buildRouter(zap.NewNop().Sugar(), Usecases{}, Options{})
+
+	// types of different packages share names
+	for _, name := range []string{"DtoMembership", "ModelMembership"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+
+	types := make(map[string]string)
+	for _, p := range spec.Paths["/api/v2/departments/{uuid}"]["delete"].Parameters {
+		types[p.Name] = p.Schema.Type
+	}
+	for _, p := range spec.Paths["/api/v2/employees"]["get"].Parameters {
+		types[p.Name] = p.Schema.Type
+	}
+	want := map[string]string{"dry_run": "boolean", "strategy": "string", "limit": "integer", "as_of": "string"}
+	for name, typ := range want {
+		if types[name] != typ {
+			t.Errorf("parameter %s has type %q, want %q", name, types[name], typ)
+		}
+	}
+}
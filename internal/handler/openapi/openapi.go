@@ -0,0 +1,308 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+)
+
+// Document is OpenAPI 3 specification of the service.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+	Security   []SecurityRequirement            `json:"security,omitempty"`
+	// schemaTypes are types of component schemas by their names
+	schemaTypes map[string]reflect.Type
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes accepted credentials.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+// SecurityRequirement maps scheme names to scopes, any of requirements
+// in the list is enough.
+type SecurityRequirement map[string][]string
+
+type Operation struct {
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *Body               `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Security is empty list for public operations
+	Security *[]SecurityRequirement `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type Body struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+}
+
+const jsonContent = "application/json"
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Build generates specification from route descriptions, request and
+// response schemas are derived from dto types by reflection.
+func Build(title, version string, routes []web.Route) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]*SecurityScheme{
+				"apiKey":     {Type: "apiKey", Name: "X-API-Key", In: "header"},
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		Security:    []SecurityRequirement{{"apiKey": {}}, {"bearerAuth": {}}},
+		schemaTypes: make(map[string]reflect.Type),
+	}
+	errSchema := doc.schemaFor(reflect.TypeOf(web.ErrorResponse{}))
+
+	for _, rt := range routes {
+		path, pathParams := convertPath(rt.Path)
+		op := &Operation{Summary: rt.Summary, Responses: make(map[string]Response)}
+		if rt.Public {
+			op.Security = &[]SecurityRequirement{}
+		}
+		for _, name := range pathParams {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+			})
+		}
+		for _, param := range rt.Query {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: param.Name, In: "query", Schema: paramSchema(param.Type),
+			})
+		}
+		if rt.Request != nil {
+			contentType := rt.RequestContentType
+			if contentType == "" {
+				contentType = jsonContent
+			}
+			op.RequestBody = &Body{
+				Required: true,
+				Content:  map[string]MediaType{contentType: {Schema: doc.schemaFor(reflect.TypeOf(rt.Request))}},
+			}
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		op.Responses[strconv.Itoa(status)] = Response{Description: http.StatusText(status)}
+		if rt.Response != nil {
+			// body of no content routes is returned with 200, e.g. dry runs
+			if status == http.StatusNoContent {
+				status = http.StatusOK
+			}
+			contentType := rt.ContentType
+			if contentType == "" {
+				contentType = jsonContent
+			}
+			op.Responses[strconv.Itoa(status)] = Response{
+				Description: http.StatusText(status),
+				Content:     map[string]MediaType{contentType: {Schema: doc.schemaFor(reflect.TypeOf(rt.Response))}},
+			}
+		}
+		op.Responses["default"] = Response{
+			Description: "Error",
+			Content:     map[string]MediaType{jsonContent: {Schema: errSchema}},
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][strings.ToLower(rt.Method)] = op
+	}
+	return doc
+}
+
+// Missing returns registered routes absent in the specification.
+func (doc *Document) Missing(registered []web.RouteKey) []string {
+	var missing []string
+	for _, rt := range registered {
+		path, _ := convertPath(rt.Path)
+		if _, ok := doc.Paths[path][strings.ToLower(rt.Method)]; !ok {
+			missing = append(missing, rt.Method+" "+rt.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Handler serves specification as json.
+func (doc *Document) Handler() http.HandlerFunc {
+	jsonData, err := json.Marshal(doc)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "can't marshal specification", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", jsonContent)
+		w.Write(jsonData)
+	}
+}
+
+// paramSchema describes query parameter of web.Param* type.
+func paramSchema(paramType string) *Schema {
+	switch paramType {
+	case web.ParamInt:
+		return &Schema{Type: "integer"}
+	case web.ParamBool:
+		return &Schema{Type: "boolean"}
+	case web.ParamTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	default:
+		return &Schema{Type: "string"}
+	}
+}
+
+// convertPath turns httprouter path /a/:id into /a/{id}.
+func convertPath(path string) (string, []string) {
+	var params []string
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") || strings.HasPrefix(p, "*") {
+			params = append(params, p[1:])
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// schemaFor describes type, named structs are put to components.
+func (doc *Document) schemaFor(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		// arbitrary json value
+		return &Schema{}
+	case t.Kind() == reflect.Ptr:
+		s := doc.schemaFor(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		nullable := *s
+		nullable.Nullable = true
+		return &nullable
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: doc.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t)
+		}
+		name := schemaName(t)
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		if known, ok := doc.schemaTypes[name]; ok {
+			if known != t {
+				panic("openapi: schema " + name + " of both " + known.PkgPath() + " and " + t.PkgPath())
+			}
+			return ref
+		}
+		// placeholder breaks recursion of self referencing types
+		doc.schemaTypes[name] = t
+		doc.Components.Schemas[name] = &Schema{}
+		doc.Components.Schemas[name] = doc.structSchema(t)
+		return ref
+	default:
+		return &Schema{}
+	}
+}
+
+// schemaName qualifies name of type with its package, like DtoMembership,
+// since types of different packages share names.
+func schemaName(t reflect.Type) string {
+	pkg := path.Base(t.PkgPath())
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
+
+func (doc *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		s.Properties[name] = doc.schemaFor(f.Type)
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SwaggerUIVersion is version of bundled swagger-ui-dist.
+const SwaggerUIVersion = "5.18.2"
+
+// UIAssets are bundled files Swagger UI page loads.
+var UIAssets = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var uiFiles embed.FS
+
+// uiPage is data of Swagger UI page, Assets is url prefix of UIAssets.
+type uiPage struct {
+	SpecURL string
+	Assets  string
+}
+
+var uiTemplate = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>API documentation</title>
+  <link rel="stylesheet" href="{{.Assets}}/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{.Assets}}/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({ url: {{.SpecURL}}, dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`))
+
+// UIHandler serves Swagger UI page for specification at specURL, assets are
+// loaded from assetsURL.
+func UIHandler(log *zap.SugaredLogger, specURL, assetsURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// page is rendered first, so a failure still gets its status
+		var buf bytes.Buffer
+		if err := uiTemplate.Execute(&buf, uiPage{SpecURL: specURL, Assets: assetsURL}); err != nil {
+			log.Errorw("ERROR", "ERROR", "can't render swagger ui: "+err.Error())
+			http.Error(w, "can't render documentation", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			log.Errorw("ERROR", "ERROR", "can't write swagger ui: "+err.Error())
+		}
+	}
+}
+
+// AssetHandler serves bundled Swagger UI file, one of UIAssets.
+func AssetHandler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := uiFiles.ReadFile("swagger-ui/" + name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		// files change only with the service, version keeps caches apart
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Header().Set("ETag", `"`+SwaggerUIVersion+"-"+name+`"`)
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+	}
+}
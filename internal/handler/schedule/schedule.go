@@ -0,0 +1,136 @@
+package schedule_handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const (
+	scheduleURL        = "/api/schedule"
+	scheduleChangeURL  = "/api/schedule/:uuid"
+	schedulePreviewURL = "/api/schedule/:uuid/preview"
+	scheduleCancelURL  = "/api/schedule/:uuid/cancel"
+)
+
+type Handler struct {
+	log   *zap.SugaredLogger
+	uCase *usecase.Schedule
+}
+
+func New(log *zap.SugaredLogger, uCase *usecase.Schedule) Handler {
+	return Handler{log: log, uCase: uCase}
+}
+
+// Routes describes routes of scheduled changes.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodPost, Path: scheduleURL, Summary: "Schedule department move, rename or employee transfer",
+			Handler: h.Create, Request: dto.CreateScheduledChange{}, Response: dto.ScheduledChange{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: scheduleURL, Summary: "List scheduled changes",
+			Handler: h.GetAll, Response: []dto.ScheduledChange{}, Query: []web.QueryParam{web.StringParam("status"), web.IntParam("limit"), web.IntParam("offset")}},
+		{Method: http.MethodGet, Path: scheduleChangeURL, Summary: "Scheduled change",
+			Handler: h.Get, Response: dto.ScheduledChange{}},
+		{Method: http.MethodGet, Path: schedulePreviewURL, Summary: "Subject of scheduled change before and after it",
+			Handler: h.Preview, Response: dto.ScheduledChangePreview{}},
+		{Method: http.MethodPost, Path: scheduleCancelURL, Summary: "Cancel pending change",
+			Handler: h.Cancel, Response: dto.ScheduledChange{}},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &dto.CreateScheduledChange{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	c, err := h.uCase.CreateChange(ctx, req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't schedule change: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusCreated, c)
+}
+
+func (h Handler) GetAll(w http.ResponseWriter, r *http.Request) {
+	q := web.NewQuery(r)
+	f := &dto.ListScheduledChanges{
+		Status: q.String("status"),
+		Limit:  q.Int("limit"),
+		Offset: q.Int("offset"),
+	}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := f.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	changes, total, err := h.uCase.GetChanges(r.Context(), f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get scheduled changes: %w", err))
+		return
+	}
+
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, changes)
+}
+
+func (h Handler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	c, err := h.uCase.GetChange(ctx, params.ByName("uuid"))
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get scheduled change: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, c)
+}
+
+func (h Handler) Preview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	p, err := h.uCase.PreviewChange(ctx, params.ByName("uuid"))
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't preview scheduled change: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, p)
+}
+
+func (h Handler) Cancel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	c, err := h.uCase.CancelChange(ctx, params.ByName("uuid"))
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't cancel scheduled change: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, c)
+}
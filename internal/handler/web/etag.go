@@ -0,0 +1,34 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+)
+
+// SetETag sets strong entity tag built from resource version.
+func SetETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// IfMatch returns version expected by client, zero when precondition is
+// absent or "*".
+func IfMatch(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+	v = strings.TrimPrefix(v, "W/")
+	v = strings.Trim(v, `"`)
+	version, err := strconv.Atoi(v)
+	if err != nil || version <= 0 {
+		if err == nil {
+			err = errors.New("non positive version")
+		}
+		return 0, apperror.BadRequest("malformed If-Match header", err)
+	}
+	return version, nil
+}
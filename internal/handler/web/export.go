@@ -0,0 +1,111 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"go.uber.org/zap"
+)
+
+// Export formats, ndjson is accepted as another name of jsonl.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// ExportParams are query parameters of export routes.
+var ExportParams = []QueryParam{StringParam("format")}
+
+// flushEvery is amount of rows sent to client at once.
+const flushEvery = 100
+
+// Record is a row of export.
+type Record interface {
+	Record() []string
+}
+
+// ExportFormat reads format of export, csv by default.
+func ExportFormat(r *http.Request) (string, error) {
+	switch f := r.URL.Query().Get("format"); f {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatJSONL, "ndjson":
+		return FormatJSONL, nil
+	default:
+		return "", apperror.BadRequest("format must be csv or jsonl, got "+f, nil)
+	}
+}
+
+// RowWriter streams rows to the client as they are read, so the whole
+// export is never kept in memory.
+type RowWriter struct {
+	w    http.ResponseWriter
+	csv  *csv.Writer
+	json *json.Encoder
+	rows int
+}
+
+// NewRowWriter writes headers of export named name and csv header with columns.
+func NewRowWriter(w http.ResponseWriter, format, name string, columns []string) (*RowWriter, error) {
+	rw := &RowWriter{w: w}
+	if format == FormatJSONL {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.jsonl"`)
+		rw.json = json.NewEncoder(w)
+		return rw, nil
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	rw.csv = csv.NewWriter(w)
+	return rw, rw.csv.Write(columns)
+}
+
+func (rw *RowWriter) Write(row Record) error {
+	var err error
+	if rw.json != nil {
+		err = rw.json.Encode(row)
+	} else {
+		err = rw.csv.Write(row.Record())
+	}
+	if err != nil {
+		return err
+	}
+	rw.rows++
+	if rw.rows%flushEvery == 0 {
+		return rw.Flush()
+	}
+	return nil
+}
+
+// Flush sends buffered rows to the client.
+func (rw *RowWriter) Flush() error {
+	if rw.csv != nil {
+		rw.csv.Flush()
+		if err := rw.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Error writes err to the client if no rows were written yet, otherwise
+// status may be already sent and err can only be logged.
+func (rw *RowWriter) Error(log *zap.SugaredLogger, err error) {
+	// csv header is still in the buffer of csv writer and is dropped
+	if rw.rows == 0 {
+		rw.w.Header().Del("Content-Disposition")
+		Error(rw.w, log, err)
+		return
+	}
+	log.Errorw("ERROR", "ERROR", err.Error())
+}
+
+// Rows returns amount of written rows.
+func (rw *RowWriter) Rows() int {
+	return rw.rows
+}
@@ -0,0 +1,125 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+)
+
+// Query reads typed url query parameters remembering the first error.
+type Query struct {
+	values url.Values
+	err    error
+}
+
+func NewQuery(r *http.Request) *Query {
+	return &Query{values: r.URL.Query()}
+}
+
+func (q *Query) String(key string) string {
+	return q.values.Get(key)
+}
+
+// Int parses optional integer parameter, missing one gives zero.
+func (q *Query) Int(key string) int {
+	v := q.values.Get(key)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil && q.err == nil {
+		q.err = apperror.BadRequest(key+" must be an integer", err)
+	}
+	return n
+}
+
+// Bool parses optional boolean parameter, missing one gives false.
+func (q *Query) Bool(key string) bool {
+	v := q.values.Get(key)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil && q.err == nil {
+		q.err = apperror.BadRequest(key+" must be true or false", err)
+	}
+	return b
+}
+
+// Time parses optional RFC 3339 timestamp or plain date, missing one gives
+// zero time.
+func (q *Query) Time(key string) time.Time {
+	v := q.values.Get(key)
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", v)
+	}
+	if err != nil && q.err == nil {
+		q.err = apperror.BadRequest(key+" must be a date or RFC 3339 timestamp", err)
+	}
+	return t
+}
+
+func (q *Query) Err() error {
+	return q.err
+}
+
+// SetPageHeaders reports total count of items and link to the next page.
+func SetPageHeaders(w http.ResponseWriter, r *http.Request, total, limit, offset int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if limit <= 0 || offset+limit >= total {
+		return
+	}
+	next := *r.URL
+	q := next.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset+limit))
+	next.RawQuery = q.Encode()
+	w.Header().Set("Link", `<`+next.RequestURI()+`>; rel="next"`)
+}
+
+// Names of list parameters for api documentation.
+var (
+	ListEmployeesParams = []QueryParam{IntParam("limit"), IntParam("offset"), StringParam("sort"), StringParam("surname"),
+		IntParam("birthyear_from"), IntParam("birthyear_to"), StringParam("department_id"), TimeParam("as_of")}
+	ListDepartmentsParams = []QueryParam{IntParam("limit"), IntParam("offset"), StringParam("sort"), StringParam("name"),
+		TimeParam("as_of"), StringParam("weight"), BoolParam("distinct")}
+)
+
+// ListEmployees reads employee list parameters from the query.
+func ListEmployees(r *http.Request) (*dto.ListEmployees, error) {
+	q := NewQuery(r)
+	f := &dto.ListEmployees{
+		Limit:         q.Int("limit"),
+		Offset:        q.Int("offset"),
+		Sort:          q.String("sort"),
+		SurnamePrefix: q.String("surname"),
+		BirthYearFrom: q.Int("birthyear_from"),
+		BirthYearTo:   q.Int("birthyear_to"),
+		DepartmentID:  q.String("department_id"),
+		AsOf:          q.Time("as_of"),
+	}
+	return f, q.Err()
+}
+
+// ListDepartments reads department list parameters from the query.
+func ListDepartments(r *http.Request) (*dto.ListDepartments, error) {
+	q := NewQuery(r)
+	f := &dto.ListDepartments{
+		Limit:      q.Int("limit"),
+		Offset:     q.Int("offset"),
+		Sort:       q.String("sort"),
+		NamePrefix: q.String("name"),
+		AsOf:       q.Time("as_of"),
+		Weight:     q.String("weight"),
+		Distinct:   q.Bool("distinct"),
+	}
+	return f, q.Err()
+}
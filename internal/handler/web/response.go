@@ -0,0 +1,66 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"go.uber.org/zap"
+)
+
+// ErrorResponse is a stable error body returned to clients.
+type ErrorResponse struct {
+	Code    apperror.Code `json:"code"`
+	Message string        `json:"message"`
+	Details interface{}   `json:"details,omitempty"`
+}
+
+// Status maps domain error code to http status.
+func Status(code apperror.Code) int {
+	switch code {
+	case apperror.CodeBadRequest:
+		return http.StatusBadRequest
+	case apperror.CodeValidation, apperror.CodeConstraint:
+		return http.StatusUnprocessableEntity
+	case apperror.CodeUnauthorized:
+		return http.StatusUnauthorized
+	case apperror.CodeForbidden:
+		return http.StatusForbidden
+	case apperror.CodeNotFound:
+		return http.StatusNotFound
+	case apperror.CodeConflict, apperror.CodeHasDescendants:
+		return http.StatusConflict
+	case apperror.CodePrecondition:
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error logs err and writes it to the client without internal details.
+func Error(w http.ResponseWriter, log *zap.SugaredLogger, err error) {
+	log.Errorw("ERROR", "ERROR", err.Error())
+
+	resp := ErrorResponse{Code: apperror.CodeInternal, Message: "internal server error"}
+	var e *apperror.Error
+	if errors.As(err, &e) {
+		resp = ErrorResponse{Code: e.Code, Message: e.Message, Details: e.Details}
+	}
+	JSON(w, log, Status(resp.Code), resp)
+}
+
+// JSON writes v with status.
+func JSON(w http.ResponseWriter, log *zap.SugaredLogger, status int, v interface{}) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		log.Errorw("ERROR", "ERROR", "can't marshal response: "+err.Error())
+		status = http.StatusInternalServerError
+		jsonData = []byte(`{"code":"internal_error","message":"internal server error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(jsonData); err != nil {
+		log.Errorw("ERROR", "ERROR", "can't write json data: "+err.Error())
+	}
+}
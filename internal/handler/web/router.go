@@ -0,0 +1,87 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Route describes endpoint for registration and api documentation.
+type Route struct {
+	Method  string
+	Path    string
+	Summary string
+	// Handler is nil for documented routes served by a dispatcher
+	// of another route (see employee_handler.getByIDOrAction).
+	Handler http.HandlerFunc
+	// Request and Response are zero values of body types, nil if there is no body.
+	Request  interface{}
+	Response interface{}
+	// RequestContentType is media type of Request, application/json if not set.
+	RequestContentType string
+	// Status is success status, http.StatusOK if not set.
+	Status int
+	// ContentType is media type of Response, application/json if not set.
+	ContentType string
+	// Query lists supported query parameters.
+	Query []QueryParam
+	// Public routes are served without authentication.
+	Public bool
+}
+
+// Types of query parameters, each is parsed by Query method of the same name.
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+	ParamTime   = "time"
+)
+
+// QueryParam describes query parameter for api documentation.
+type QueryParam struct {
+	Name string
+	Type string
+}
+
+func StringParam(name string) QueryParam {
+	return QueryParam{Name: name, Type: ParamString}
+}
+
+func IntParam(name string) QueryParam {
+	return QueryParam{Name: name, Type: ParamInt}
+}
+
+func BoolParam(name string) QueryParam {
+	return QueryParam{Name: name, Type: ParamBool}
+}
+
+func TimeParam(name string) QueryParam {
+	return QueryParam{Name: name, Type: ParamTime}
+}
+
+// RouteKey identifies registered route.
+type RouteKey struct {
+	Method string
+	Path   string
+}
+
+// Router is httprouter that remembers registered routes,
+// so they can be checked against api documentation.
+type Router struct {
+	*httprouter.Router
+	registered []RouteKey
+}
+
+func NewRouter() *Router {
+	return &Router{Router: httprouter.New()}
+}
+
+func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.registered = append(r.registered, RouteKey{Method: method, Path: path})
+	r.Router.HandlerFunc(method, path, handler)
+}
+
+// Registered returns all routes registered with HandlerFunc.
+func (r *Router) Registered() []RouteKey {
+	return r.registered
+}
@@ -0,0 +1,119 @@
+package webhook_handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	"github.com/dimashiro/test_mediasoft/internal/middleware"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+const (
+	webhooksURL   = "/api/webhooks"
+	webhookURL    = "/api/webhooks/:uuid"
+	deliveriesURL = "/api/webhooks/deliveries"
+)
+
+type Handler struct {
+	log   *zap.SugaredLogger
+	uCase *usecase.Webhook
+}
+
+func New(log *zap.SugaredLogger, uCase *usecase.Webhook) Handler {
+	return Handler{log: log, uCase: uCase}
+}
+
+// Routes describes routes of webhook subscriptions.
+func (h Handler) Routes() []web.Route {
+	return []web.Route{
+		{Method: http.MethodPost, Path: webhooksURL, Summary: "Subscribe url to change events",
+			Handler: h.Create, Request: dto.CreateWebhook{}, Response: dto.Webhook{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: webhooksURL, Summary: "List webhooks",
+			Handler: h.GetAll, Response: []dto.Webhook{}},
+		{Method: http.MethodDelete, Path: webhookURL, Summary: "Delete webhook with its deliveries",
+			Handler: h.Delete, Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: deliveriesURL, Summary: "Webhook deliveries, status=dead lists dead letters",
+			Handler: h.GetDeliveries, Response: []dto.WebhookDelivery{},
+			Query: []web.QueryParam{web.StringParam("webhook_id"), web.StringParam("status"), web.IntParam("limit"), web.IntParam("offset")}},
+	}
+}
+
+func (h Handler) Register(r *web.Router) {
+	for _, rt := range h.Routes() {
+		r.HandlerFunc(rt.Method, rt.Path, middleware.Logging(h.log, rt.Handler))
+	}
+}
+
+func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
+	req := &dto.CreateWebhook{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		web.Error(w, h.log, apperror.BadRequest("bad json", err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	wh, err := h.uCase.CreateWebhook(r.Context(), req)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't create webhook: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusCreated, wh)
+}
+
+func (h Handler) GetAll(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.uCase.GetWebhooks(r.Context())
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get webhooks: %w", err))
+		return
+	}
+
+	web.JSON(w, h.log, http.StatusOK, webhooks)
+}
+
+func (h Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	params := ctx.Value(httprouter.ParamsKey).(httprouter.Params)
+	if err := h.uCase.DeleteWebhook(ctx, params.ByName("uuid")); err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't delete webhook: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h Handler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := web.NewQuery(r)
+	f := &dto.ListDeliveries{
+		WebhookID: q.String("webhook_id"),
+		Status:    q.String("status"),
+		Limit:     q.Int("limit"),
+		Offset:    q.Int("offset"),
+	}
+	if err := q.Err(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+	if err := f.Validate(); err != nil {
+		web.Error(w, h.log, err)
+		return
+	}
+
+	deliveries, total, err := h.uCase.GetDeliveries(r.Context(), f)
+	if err != nil {
+		web.Error(w, h.log, fmt.Errorf("can't get deliveries: %w", err))
+		return
+	}
+
+	web.SetPageHeaders(w, r, total, f.Limit, f.Offset)
+	web.JSON(w, h.log, http.StatusOK, deliveries)
+}
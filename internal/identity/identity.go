@@ -0,0 +1,52 @@
+// Package identity keeps the caller of request in context.
+package identity
+
+import "context"
+
+// Anonymous is actor of requests without identity.
+const Anonymous = "anonymous"
+
+// Methods of authentication.
+const (
+	MethodAPIKey   = "api_key"
+	MethodAdminKey = "admin_key"
+	MethodJWT      = "jwt"
+	// MethodJob is background job, trusted ones act as admin and the others
+	// with rights of the one who created them
+	MethodJob = "job"
+)
+
+// Identity is authenticated caller. Subject names it in logs, audit and
+// role grants, Admin callers are allowed everything.
+type Identity struct {
+	Subject string
+	Method  string
+	Admin   bool
+}
+
+type identityKey struct{}
+
+// WithIdentity returns context carrying authenticated caller.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns caller stored in context, false if there is none.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok && id.Subject != ""
+}
+
+// WithActor returns context of trusted background job acting on behalf of
+// actor with admin rights, such as maintenance commands.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return WithIdentity(ctx, Identity{Subject: actor, Method: MethodJob, Admin: true})
+}
+
+// Actor returns actor stored in context or Anonymous.
+func Actor(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok {
+		return id.Subject
+	}
+	return Anonymous
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/dimashiro/test_mediasoft/internal/handler/web"
+	"github.com/dimashiro/test_mediasoft/internal/identity"
+	"go.uber.org/zap"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	bearerPrefix = "Bearer "
+)
+
+// Authenticator finds caller by api key or bearer token.
+type Authenticator interface {
+	Authenticate(ctx context.Context, key, token string) (identity.Identity, error)
+}
+
+// Auth rejects requests without valid api key or bearer token, except
+// requests of public paths, and puts caller into request context.
+func Auth(log *zap.SugaredLogger, authn Authenticator, public map[string]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if public[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var token string
+		if h := r.Header.Get("Authorization"); len(h) > len(bearerPrefix) && strings.EqualFold(h[:len(bearerPrefix)], bearerPrefix) {
+			token = strings.TrimSpace(h[len(bearerPrefix):])
+		}
+		id, err := authn.Authenticate(r.Context(), r.Header.Get(apiKeyHeader), token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			web.Error(w, log, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), id)))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dimashiro/test_mediasoft/internal/identity"
 	"go.uber.org/zap"
 )
 
@@ -12,6 +13,7 @@ func Logging(log *zap.SugaredLogger, next http.HandlerFunc) http.HandlerFunc {
 		start := time.Now()
 		next.ServeHTTP(w, r)
 		log.Infow("request completed", "method", r.Method, "path", r.URL.Path,
-			"remoteaddr", r.RemoteAddr, "since", time.Since(start))
+			"remoteaddr", r.RemoteAddr, "actor", identity.Actor(r.Context()),
+			"since", time.Since(start))
 	}
 }
@@ -1,8 +1,22 @@
 package model
 
+// Department is headed by employee with HeadID, nil if there is none.
 type Department struct {
 	ID       string
 	Name     string
 	Path     string
+	HeadID   *string
+	Version  int
 	Children []*Department
 }
+
+// Hierarchy is department forest assembled by parent references. Orphans
+// are departments whose path disagrees with their parent, they are still
+// placed under the parent they reference or among roots if there is none.
+// Orphans also include departments unreachable from roots because parent
+// references form a cycle, these are left out of the forest.
+type Hierarchy struct {
+	Departments map[string]*Department
+	Roots       []*Department
+	Orphans     []*Department
+}
@@ -0,0 +1,26 @@
+package dto
+
+import "time"
+
+// CreateAPIKey issues key named after its owner, admin keys may manage keys.
+type CreateAPIKey struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+// APIKey describes issued key, the key itself is never stored.
+type APIKey struct {
+	ID         string
+	Name       string
+	Prefix     string
+	Admin      bool
+	CreatedBy  string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// NewAPIKey is returned once on creation, Key can't be read again.
+type NewAPIKey struct {
+	APIKey
+	Key string
+}
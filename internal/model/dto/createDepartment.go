@@ -3,4 +3,5 @@ package dto
 type CreateDepartment struct {
 	Name     string `json:"name"`
 	ParentID string `json:"parent_id"`
+	HeadID   string `json:"head_id"`
 }
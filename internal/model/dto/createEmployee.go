@@ -1,8 +1,11 @@
 package dto
 
+// CreateEmployee takes either departments or memberships with positions.
 type CreateEmployee struct {
-	Name        string   `json:"name"`
-	Surname     string   `json:"surname"`
-	BirthYear   int      `json:"birthyear"`
-	Departments []string `json:"departments_ids"`
+	Name        string       `json:"name"`
+	Surname     string       `json:"surname"`
+	BirthYear   int          `json:"birthyear"`
+	Departments []string     `json:"departments_ids"`
+	Memberships []Membership `json:"memberships"`
+	ManagerID   string       `json:"manager_id"`
 }
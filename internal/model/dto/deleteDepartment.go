@@ -1,5 +1,28 @@
 package dto
 
+const (
+	// DeleteStrategyCascade removes department with its subtree and memberships.
+	DeleteStrategyCascade = "cascade"
+	// DeleteStrategyReparent lifts children to the parent of deleted department.
+	DeleteStrategyReparent = "reparent"
+	// DeleteStrategyReassign moves members of deleted department to TargetID,
+	// department must not have children.
+	DeleteStrategyReassign = "reassign"
+)
+
 type DeleteDepartment struct {
-	ID string `json:"id"`
+	ID       string `json:"id"`
+	Strategy string `json:"strategy"`
+	TargetID string `json:"target_id"`
+	DryRun   bool   `json:"dry_run"`
+	Version  int    `json:"-"`
+}
+
+type DeleteDepartmentResult struct {
+	DryRun                bool
+	Strategy              string
+	DeletedDepartments    []string
+	ReparentedDepartments int
+	DeletedMemberships    int
+	ReassignedMemberships int
 }
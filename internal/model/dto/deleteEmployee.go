@@ -1,5 +1,6 @@
 package dto
 
 type DeleteEmployee struct {
-	ID string `json:"id"`
+	ID      string `json:"id"`
+	Version int    `json:"-"`
 }
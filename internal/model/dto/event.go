@@ -0,0 +1,33 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of change events.
+const (
+	EventEmployeeCreated   = "employee.created"
+	EventEmployeeUpdated   = "employee.updated"
+	EventEmployeeDeleted   = "employee.deleted"
+	EventDepartmentCreated = "department.created"
+	EventDepartmentUpdated = "department.updated"
+	EventDepartmentMoved   = "department.moved"
+	EventDepartmentDeleted = "department.deleted"
+	EventMembershipChanged = "membership.changed"
+)
+
+var EventTypes = []string{
+	EventEmployeeCreated, EventEmployeeUpdated, EventEmployeeDeleted,
+	EventDepartmentCreated, EventDepartmentUpdated, EventDepartmentMoved, EventDepartmentDeleted,
+	EventMembershipChanged,
+}
+
+// Event is a change event as it is sent to subscribers.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	EntityID  string          `json:"entity_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
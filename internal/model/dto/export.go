@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"strconv"
+	"strings"
+)
+
+// EmployeeExportColumns are columns of employee csv export, compatible
+// with employee import.
+var EmployeeExportColumns = []string{"id", "name", "surname", "birthyear", "departments"}
+
+// EmployeeExportRow is employee with full paths of current departments.
+type EmployeeExportRow struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Surname     string   `json:"surname"`
+	BirthYear   int      `json:"birthyear"`
+	Departments []string `json:"departments"`
+}
+
+func (e EmployeeExportRow) Record() []string {
+	return []string{e.ID, e.Name, e.Surname, strconv.Itoa(e.BirthYear), strings.Join(e.Departments, "; ")}
+}
+
+var DepartmentExportColumns = []string{"id", "name", "parent_id", "full_path", "level", "members"}
+
+// DepartmentExportRow is department with full path of names and amount of
+// its current members.
+type DepartmentExportRow struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id"`
+	FullPath string `json:"full_path"`
+	Level    int    `json:"level"`
+	Members  int    `json:"members"`
+}
+
+func (d DepartmentExportRow) Record() []string {
+	return []string{d.ID, d.Name, d.ParentID, d.FullPath, strconv.Itoa(d.Level), strconv.Itoa(d.Members)}
+}
@@ -0,0 +1,38 @@
+package dto
+
+import "time"
+
+// Roles granted on departments, each includes rights of the previous one.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// CreateGrant gives subject role on department and its subtree, existing
+// grant of subject on the department is replaced.
+type CreateGrant struct {
+	Subject      string `json:"subject"`
+	DepartmentID string `json:"department_id"`
+	Role         string `json:"role"`
+}
+
+type Grant struct {
+	ID           string
+	Subject      string
+	DepartmentID string
+	Role         string
+	GrantedBy    string
+	CreatedAt    time.Time
+}
+
+// ListGrants filters grants by subject and by department, grants within
+// subtree of the department are listed.
+type ListGrants struct {
+	Subject      string
+	DepartmentID string
+	Limit        int
+	Offset       int
+}
@@ -0,0 +1,37 @@
+package dto
+
+import "github.com/dimashiro/test_mediasoft/internal/model"
+
+// ImportColumns are columns of employee import csv, departments column
+// holds department ids or full paths like "Software / Web" separated by ";".
+var ImportColumns = []string{"name", "surname", "birthyear", "departments"}
+
+// ImportEmployeeRow is a csv row as it is, Line is line of the row in file.
+type ImportEmployeeRow struct {
+	Line        int
+	Name        string
+	Surname     string
+	BirthYear   string
+	Departments []string
+}
+
+type ImportEmployees struct {
+	Rows   []ImportEmployeeRow
+	DryRun bool
+}
+
+// ImportRowError describes invalid field of row, empty Field means the
+// row as a whole.
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportEmployeesResult lists employees created by import, ids of dry run
+// employees are not saved.
+type ImportEmployeesResult struct {
+	DryRun    bool
+	Created   int
+	Employees []model.Employee
+}
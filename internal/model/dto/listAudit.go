@@ -0,0 +1,32 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entities that are written to audit log.
+const (
+	AuditEntityDepartment = "department"
+	AuditEntityEmployee   = "employee"
+)
+
+type ListAudit struct {
+	Entity   string
+	EntityID string
+	Since    time.Time
+	Limit    int
+	Offset   int
+}
+
+type AuditEvent struct {
+	ID        int64
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  string
+	Before    json.RawMessage
+	After     json.RawMessage
+	Diff      json.RawMessage
+	CreatedAt time.Time
+}
@@ -0,0 +1,23 @@
+package dto
+
+import "time"
+
+// Sort keys accepted by department list, prefix "-" means descending order.
+var DepartmentSortKeys = []string{"name"}
+
+// WeightFTE weights member counts by FTE shares of memberships.
+const WeightFTE = "fte"
+
+type ListDepartments struct {
+	Limit      int
+	Offset     int
+	Sort       string
+	NamePrefix string
+	// AsOf is moment of memberships used for member counts.
+	AsOf time.Time
+	// Weight adds weighted member counts, only WeightFTE is known.
+	Weight string
+	// Distinct counts person once in hierarchy counts even if it is member
+	// of several departments of the subtree.
+	Distinct bool
+}
@@ -0,0 +1,21 @@
+package dto
+
+import "time"
+
+// Sort keys accepted by employee lists, prefix "-" means descending order.
+var EmployeeSortKeys = []string{"name", "surname", "birthyear"}
+
+type ListEmployees struct {
+	Limit         int
+	Offset        int
+	Sort          string
+	SurnamePrefix string
+	BirthYearFrom int
+	BirthYearTo   int
+	DepartmentID  string
+	// AsOf selects memberships valid at that moment, zero means current ones.
+	AsOf time.Time
+	// Distinct returns person once with all matched memberships in lists
+	// of department hierarchy.
+	Distinct bool
+}
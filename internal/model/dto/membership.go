@@ -0,0 +1,20 @@
+package dto
+
+// Membership is position of employee in department given on create or
+// update. FTE is share of full time in (0, 1], nil means full time. At
+// most one membership of employee is primary.
+type Membership struct {
+	DepartmentID string   `json:"department_id"`
+	Position     string   `json:"position"`
+	FTE          *float64 `json:"fte"`
+	Primary      bool     `json:"is_primary"`
+}
+
+// MembershipDepartments returns department ids of memberships.
+func MembershipDepartments(memberships []Membership) []string {
+	ids := make([]string, 0, len(memberships))
+	for _, m := range memberships {
+		ids = append(ids, m.DepartmentID)
+	}
+	return ids
+}
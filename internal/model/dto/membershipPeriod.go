@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+// MembershipPeriod is a membership of employee in department, nil ValidTo
+// means that membership is current.
+type MembershipPeriod struct {
+	DepartmentID   string
+	DepartmentName string
+	FullPath       string
+	ValidFrom      time.Time
+	ValidTo        *time.Time
+}
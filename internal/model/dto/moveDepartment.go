@@ -0,0 +1,7 @@
+package dto
+
+type MoveDepartment struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parent_id"`
+	Version  int    `json:"-"`
+}
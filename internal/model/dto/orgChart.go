@@ -0,0 +1,24 @@
+package dto
+
+// Kinds of org chart nodes.
+const (
+	OrgNodeDepartment = "department"
+	OrgNodeEmployee   = "employee"
+)
+
+type OrgChart struct {
+	// RootID limits chart to subtree of department, empty means whole org.
+	RootID string
+	// WithEmployees adds employees as leaves of their departments.
+	WithEmployees bool
+}
+
+// OrgNode is department or employee in org chart, Members is amount of
+// current direct members of department.
+type OrgNode struct {
+	ID       string
+	Kind     string
+	Name     string
+	Members  int
+	Children []*OrgNode
+}
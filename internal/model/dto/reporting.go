@@ -0,0 +1,23 @@
+package dto
+
+type EmployeeRef struct {
+	ID      string
+	Name    string
+	Surname string
+}
+
+// ReportingNode is employee with people reporting to it.
+type ReportingNode struct {
+	ID      string
+	Name    string
+	Surname string
+	Reports []*ReportingNode
+}
+
+// ReportingTree requests employee with everyone reporting to it directly
+// or through other managers, Depth limits levels below it, zero means no
+// limit.
+type ReportingTree struct {
+	ID    string
+	Depth int
+}
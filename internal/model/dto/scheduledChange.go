@@ -0,0 +1,67 @@
+package dto
+
+import "time"
+
+// Kinds of scheduled changes.
+const (
+	ChangeDepartmentMove   = "department.move"
+	ChangeDepartmentRename = "department.rename"
+	ChangeEmployeeTransfer = "employee.transfer"
+)
+
+// Statuses of scheduled changes.
+const (
+	ChangePending   = "pending"
+	ChangeApplying  = "applying"
+	ChangeApplied   = "applied"
+	ChangeFailed    = "failed"
+	ChangeCancelled = "cancelled"
+)
+
+// CreateScheduledChange plans change that is applied at EffectiveAt. Used
+// fields depend on kind: department_id and parent_id for move, department_id
+// and name for rename, employee_id and departments_ids for transfer.
+type CreateScheduledChange struct {
+	Kind         string    `json:"kind"`
+	EffectiveAt  time.Time `json:"effective_at"`
+	DepartmentID string    `json:"department_id"`
+	ParentID     string    `json:"parent_id"`
+	Name         string    `json:"name"`
+	EmployeeID   string    `json:"employee_id"`
+	Departments  []string  `json:"departments_ids"`
+}
+
+type ScheduledChange struct {
+	ID           string
+	Kind         string
+	EffectiveAt  time.Time
+	Status       string
+	DepartmentID string
+	ParentID     string
+	Name         string
+	EmployeeID   string
+	Departments  []string
+	CreatedBy    string
+	CreatedAt    time.Time
+	AppliedAt    *time.Time
+	Error        string
+	// Attempts counts claims of change, more than one means that applying
+	// was interrupted.
+	Attempts int
+}
+
+type ListScheduledChanges struct {
+	Status string
+	Limit  int
+	Offset int
+}
+
+// ScheduledChangePreview shows state of the subject now and after the change,
+// Problem explains why the change can't be applied as is.
+type ScheduledChangePreview struct {
+	Change  ScheduledChange
+	Subject string
+	Before  []string
+	After   []string
+	Problem string
+}
@@ -0,0 +1,20 @@
+package dto
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+type SearchEmployees struct {
+	Query        string
+	DepartmentID string
+	Limit        int
+}
+
+type EmployeeSearchResult struct {
+	ID        string
+	Name      string
+	Surname   string
+	BirthYear uint16
+	Rank      float64
+}
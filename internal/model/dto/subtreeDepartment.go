@@ -0,0 +1,8 @@
+package dto
+
+// SubtreeDepartment requests department with its descendants, Depth limits
+// levels below it, zero means no limit.
+type SubtreeDepartment struct {
+	ID    string
+	Depth int
+}
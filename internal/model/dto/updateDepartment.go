@@ -4,4 +4,8 @@ type UpdateDepartment struct {
 	ID       string  `json:"id"`
 	Name     *string `json:"name"`
 	ParentID *string `json:"parent_id"`
+	// HeadID empty string removes head, nil keeps current one
+	HeadID *string `json:"head_id"`
+	// Version is expected version from If-Match header, zero skips the check
+	Version int `json:"-"`
 }
@@ -1,9 +1,15 @@
 package dto
 
+// UpdateEmployee replaces departments keeping positions of remaining ones
+// or replaces memberships with positions, nil keeps them as they are.
 type UpdateEmployee struct {
-	ID          string   `json:"id"`
-	Name        *string  `json:"name"`
-	Surname     *string  `json:"surname"`
-	BirthYear   *uint16  `json:"birthyear"`
-	Departments []string `json:"departments_ids"`
+	ID          string       `json:"id"`
+	Name        *string      `json:"name"`
+	Surname     *string      `json:"surname"`
+	BirthYear   *uint16      `json:"birthyear"`
+	Departments []string     `json:"departments_ids"`
+	Memberships []Membership `json:"memberships"`
+	// ManagerID empty string removes manager, nil keeps current one
+	ManagerID *string `json:"manager_id"`
+	Version   int     `json:"-"`
 }
@@ -0,0 +1,466 @@
+package dto
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/google/uuid"
+)
+
+const (
+	maxNameLength = 255
+	minBirthYear  = 1900
+	// DefaultPageLimit is page size of list requests without limit.
+	DefaultPageLimit = 100
+	// MaxPageLimit caps page size of list requests.
+	MaxPageLimit = 1000
+	// MaxImportRows caps amount of employees imported at once.
+	MaxImportRows = 1000
+)
+
+// Validator is implemented by request dto that can check themselves.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes single invalid field of request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fieldErrors collects all field errors of request at once.
+type fieldErrors []FieldError
+
+func (fe *fieldErrors) add(field, msg string) {
+	*fe = append(*fe, FieldError{Field: field, Message: msg})
+}
+
+func (fe fieldErrors) err() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return apperror.Validation("request validation failed", []FieldError(fe))
+}
+
+func (fe *fieldErrors) uuid(field, v string) {
+	if v == "" {
+		fe.add(field, "is required")
+		return
+	}
+	if _, err := uuid.Parse(v); err != nil {
+		fe.add(field, "must be a valid uuid")
+	}
+}
+
+func (fe *fieldErrors) optionalUUID(field, v string) {
+	if v != "" {
+		fe.uuid(field, v)
+	}
+}
+
+func (fe *fieldErrors) name(field, v string) {
+	if strings.TrimSpace(v) == "" {
+		fe.add(field, "is required")
+		return
+	}
+	if utf8.RuneCountInString(v) > maxNameLength {
+		fe.add(field, "is too long")
+	}
+}
+
+func (fe *fieldErrors) birthYear(field string, v int) {
+	if v < minBirthYear || v > time.Now().Year() {
+		fe.add(field, "must be a year between 1900 and current year")
+	}
+}
+
+func (fe *fieldErrors) departments(field string, ids []string) {
+	if len(ids) == 0 {
+		fe.add(field, "employee must belong to at least one department")
+		return
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			fe.add(field, "must contain valid uuids, got "+id)
+			continue
+		}
+		if seen[id] {
+			fe.add(field, "contains duplicate "+id)
+		}
+		seen[id] = true
+	}
+}
+
+// memberships checks memberships given instead of departments.
+func (fe *fieldErrors) memberships(field string, ms []Membership) {
+	fe.departments(field, MembershipDepartments(ms))
+	primary := 0
+	for i, m := range ms {
+		item := field + "[" + strconv.Itoa(i) + "]"
+		if utf8.RuneCountInString(m.Position) > maxNameLength {
+			fe.add(item+".position", "is too long")
+		}
+		if m.FTE != nil && (*m.FTE <= 0 || *m.FTE > 1) {
+			fe.add(item+".fte", "must be greater than 0 and at most 1")
+		}
+		if m.Primary {
+			primary++
+		}
+	}
+	if primary > 1 {
+		fe.add(field, "only one membership can be primary")
+	}
+}
+
+func (d *CreateDepartment) Validate() error {
+	var fe fieldErrors
+	fe.name("name", d.Name)
+	fe.optionalUUID("parent_id", d.ParentID)
+	fe.optionalUUID("head_id", d.HeadID)
+	return fe.err()
+}
+
+func (d *UpdateDepartment) Validate() error {
+	var fe fieldErrors
+	fe.uuid("id", d.ID)
+	if d.Name == nil && d.ParentID == nil && d.HeadID == nil {
+		fe.add("name", "name, parent_id or head_id must be set")
+	}
+	if d.Name != nil {
+		fe.name("name", *d.Name)
+	}
+	if d.ParentID != nil {
+		fe.optionalUUID("parent_id", *d.ParentID)
+		if *d.ParentID == d.ID {
+			fe.add("parent_id", "department can't be its own parent")
+		}
+	}
+	if d.HeadID != nil {
+		fe.optionalUUID("head_id", *d.HeadID)
+	}
+	return fe.err()
+}
+
+func (d *MoveDepartment) Validate() error {
+	var fe fieldErrors
+	fe.uuid("id", d.ID)
+	fe.optionalUUID("parent_id", d.ParentID)
+	if d.ParentID == d.ID {
+		fe.add("parent_id", "department can't be its own parent")
+	}
+	return fe.err()
+}
+
+func (d *DeleteDepartment) Validate() error {
+	var fe fieldErrors
+	fe.uuid("id", d.ID)
+	switch d.Strategy {
+	case "", DeleteStrategyCascade, DeleteStrategyReparent:
+		if d.TargetID != "" {
+			fe.add("target_id", "is allowed only with reassign strategy")
+		}
+	case DeleteStrategyReassign:
+		fe.uuid("target_id", d.TargetID)
+		if d.TargetID == d.ID {
+			fe.add("target_id", "can't be the deleted department")
+		}
+	default:
+		fe.add("strategy", "must be one of cascade, reparent, reassign")
+	}
+	return fe.err()
+}
+
+func (e *CreateEmployee) Validate() error {
+	var fe fieldErrors
+	fe.name("name", e.Name)
+	fe.name("surname", e.Surname)
+	fe.birthYear("birthyear", e.BirthYear)
+	if e.Memberships != nil {
+		if e.Departments != nil {
+			fe.add("memberships", "departments_ids and memberships can't be set together")
+		}
+		fe.memberships("memberships", e.Memberships)
+	} else {
+		fe.departments("departments_ids", e.Departments)
+	}
+	fe.optionalUUID("manager_id", e.ManagerID)
+	return fe.err()
+}
+
+func (e *UpdateEmployee) Validate() error {
+	var fe fieldErrors
+	fe.uuid("id", e.ID)
+	if e.Name != nil {
+		fe.name("name", *e.Name)
+	}
+	if e.Surname != nil {
+		fe.name("surname", *e.Surname)
+	}
+	if e.BirthYear != nil {
+		fe.birthYear("birthyear", int(*e.BirthYear))
+	}
+	// nil keeps current departments, empty list is not allowed
+	if e.Departments != nil {
+		fe.departments("departments_ids", e.Departments)
+	}
+	if e.Memberships != nil {
+		if e.Departments != nil {
+			fe.add("memberships", "departments_ids and memberships can't be set together")
+		}
+		fe.memberships("memberships", e.Memberships)
+	}
+	if e.ManagerID != nil {
+		fe.optionalUUID("manager_id", *e.ManagerID)
+		if *e.ManagerID == e.ID {
+			fe.add("manager_id", "employee can't be its own manager")
+		}
+	}
+	return fe.err()
+}
+
+func (e *DeleteEmployee) Validate() error {
+	var fe fieldErrors
+	fe.uuid("id", e.ID)
+	return fe.err()
+}
+
+// page checks page parameters, missing limit is set to DefaultPageLimit.
+func (fe *fieldErrors) page(limit *int, offset int) {
+	if *limit == 0 {
+		*limit = DefaultPageLimit
+	}
+	if *limit < 0 || *limit > MaxPageLimit {
+		fe.add("limit", "must be between 1 and 1000")
+	}
+	if offset < 0 {
+		fe.add("offset", "must not be negative")
+	}
+}
+
+func (fe *fieldErrors) sort(field, v string, keys []string) {
+	if v == "" {
+		return
+	}
+	if contains(keys, strings.TrimPrefix(v, "-")) {
+		return
+	}
+	fe.add(field, "must be one of "+strings.Join(keys, ", ")+" optionally prefixed with -")
+}
+
+func (l *ListEmployees) Validate() error {
+	var fe fieldErrors
+	fe.page(&l.Limit, l.Offset)
+	fe.sort("sort", l.Sort, EmployeeSortKeys)
+	if l.BirthYearFrom < 0 {
+		fe.add("birthyear_from", "must not be negative")
+	}
+	if l.BirthYearTo < 0 {
+		fe.add("birthyear_to", "must not be negative")
+	}
+	if l.BirthYearFrom > 0 && l.BirthYearTo > 0 && l.BirthYearFrom > l.BirthYearTo {
+		fe.add("birthyear_to", "must not be less than birthyear_from")
+	}
+	fe.optionalUUID("department_id", l.DepartmentID)
+	return fe.err()
+}
+
+func (l *ListDepartments) Validate() error {
+	var fe fieldErrors
+	fe.page(&l.Limit, l.Offset)
+	fe.sort("sort", l.Sort, DepartmentSortKeys)
+	if l.Weight != "" && l.Weight != WeightFTE {
+		fe.add("weight", "must be fte")
+	}
+	return fe.err()
+}
+
+func (s *SearchEmployees) Validate() error {
+	var fe fieldErrors
+	if strings.TrimSpace(s.Query) == "" {
+		fe.add("q", "is required")
+	} else if utf8.RuneCountInString(s.Query) > maxNameLength {
+		fe.add("q", "is too long")
+	}
+	if s.Limit < 0 || s.Limit > MaxSearchLimit {
+		fe.add("limit", "must be between 0 and 100")
+	}
+	fe.optionalUUID("department_id", s.DepartmentID)
+	return fe.err()
+}
+
+func (l *ListAudit) Validate() error {
+	var fe fieldErrors
+	switch l.Entity {
+	case "", AuditEntityDepartment, AuditEntityEmployee:
+	default:
+		fe.add("entity", "must be one of department, employee")
+	}
+	fe.optionalUUID("id", l.EntityID)
+	fe.page(&l.Limit, l.Offset)
+	return fe.err()
+}
+
+func (c *CreateScheduledChange) Validate() error {
+	var fe fieldErrors
+	if c.EffectiveAt.IsZero() {
+		fe.add("effective_at", "is required")
+	} else if !c.EffectiveAt.After(time.Now()) {
+		fe.add("effective_at", "must be in the future")
+	}
+	switch c.Kind {
+	case ChangeDepartmentMove:
+		fe.uuid("department_id", c.DepartmentID)
+		fe.optionalUUID("parent_id", c.ParentID)
+		if c.ParentID != "" && c.ParentID == c.DepartmentID {
+			fe.add("parent_id", "department can't be its own parent")
+		}
+	case ChangeDepartmentRename:
+		fe.uuid("department_id", c.DepartmentID)
+		fe.name("name", c.Name)
+	case ChangeEmployeeTransfer:
+		fe.uuid("employee_id", c.EmployeeID)
+		fe.departments("departments_ids", c.Departments)
+	default:
+		fe.add("kind", "must be one of department.move, department.rename, employee.transfer")
+	}
+	return fe.err()
+}
+
+func (l *ListScheduledChanges) Validate() error {
+	var fe fieldErrors
+	switch l.Status {
+	case "", ChangePending, ChangeApplying, ChangeApplied, ChangeFailed, ChangeCancelled:
+	default:
+		fe.add("status", "must be one of pending, applying, applied, failed, cancelled")
+	}
+	fe.page(&l.Limit, l.Offset)
+	return fe.err()
+}
+
+const minSecretLength = 16
+
+func (c *CreateWebhook) Validate() error {
+	var fe fieldErrors
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fe.add("url", "must be an absolute http or https url")
+	}
+	if len(c.Secret) < minSecretLength {
+		fe.add("secret", "must be at least 16 characters")
+	}
+	for _, t := range c.EventTypes {
+		if !contains(EventTypes, t) {
+			fe.add("event_types", "unknown event type "+t)
+		}
+	}
+	return fe.err()
+}
+
+func (l *ListDeliveries) Validate() error {
+	var fe fieldErrors
+	fe.optionalUUID("webhook_id", l.WebhookID)
+	switch l.Status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryDead:
+	default:
+		fe.add("status", "must be one of pending, delivered, dead")
+	}
+	fe.page(&l.Limit, l.Offset)
+	return fe.err()
+}
+
+func (s *SubtreeDepartment) Validate() error {
+	var fe fieldErrors
+	fe.uuid("id", s.ID)
+	if s.Depth < 0 {
+		fe.add("depth", "must not be negative")
+	}
+	return fe.err()
+}
+
+func (t *ReportingTree) Validate() error {
+	var fe fieldErrors
+	fe.uuid("id", t.ID)
+	if t.Depth < 0 {
+		fe.add("depth", "must not be negative")
+	}
+	return fe.err()
+}
+
+func (o *OrgChart) Validate() error {
+	var fe fieldErrors
+	fe.optionalUUID("root", o.RootID)
+	return fe.err()
+}
+
+// Validate checks every row and reports all invalid fields with their lines.
+// Departments are resolved later, here they are only required.
+func (i *ImportEmployees) Validate() error {
+	rowErrors := []ImportRowError{}
+	if len(i.Rows) == 0 {
+		rowErrors = append(rowErrors, ImportRowError{Message: "file has no employees"})
+	}
+	if len(i.Rows) > MaxImportRows {
+		rowErrors = append(rowErrors, ImportRowError{
+			Message: "file has more than " + strconv.Itoa(MaxImportRows) + " employees"})
+	}
+	for _, row := range i.Rows {
+		var fe fieldErrors
+		fe.name("name", row.Name)
+		fe.name("surname", row.Surname)
+		if year, err := strconv.Atoi(row.BirthYear); err != nil {
+			fe.add("birthyear", "must be a number")
+		} else {
+			fe.birthYear("birthyear", year)
+		}
+		if len(row.Departments) == 0 {
+			fe.add("departments", "employee must belong to at least one department")
+		}
+		for _, e := range fe {
+			rowErrors = append(rowErrors, ImportRowError{Line: row.Line, Field: e.Field, Message: e.Message})
+		}
+	}
+	if len(rowErrors) > 0 {
+		return apperror.Validation("import validation failed", rowErrors)
+	}
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CreateAPIKey) Validate() error {
+	var fe fieldErrors
+	fe.name("name", c.Name)
+	return fe.err()
+}
+
+func (c *CreateGrant) Validate() error {
+	var fe fieldErrors
+	if strings.TrimSpace(c.Subject) == "" {
+		fe.add("subject", "is required")
+	}
+	fe.uuid("department_id", c.DepartmentID)
+	if !contains(Roles, c.Role) {
+		fe.add("role", "must be one of viewer, editor, admin")
+	}
+	return fe.err()
+}
+
+func (l *ListGrants) Validate() error {
+	var fe fieldErrors
+	fe.optionalUUID("department_id", l.DepartmentID)
+	fe.page(&l.Limit, l.Offset)
+	return fe.err()
+}
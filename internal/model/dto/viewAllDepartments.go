@@ -1,8 +1,12 @@
 package dto
 
+// ViewAllDepartments is department with member counts, FTE sums of
+// memberships are set only if they are requested.
 type ViewAllDepartments struct {
 	ID                         string
 	Name                       string
 	EmployeesAmount            int
 	EmployeesAmountInHierarchy int
+	FTEAmount                  *float64
+	FTEAmountInHierarchy       *float64
 }
@@ -0,0 +1,19 @@
+package dto
+
+type ViewDepartment struct {
+	ID                         string
+	Name                       string
+	Path                       string
+	Parent                     *DepartmentRef
+	Head                       *EmployeeRef
+	Breadcrumbs                []DepartmentRef
+	Children                   []ViewAllDepartments
+	EmployeesAmount            int
+	EmployeesAmountInHierarchy int
+	Version                    int
+}
+
+type DepartmentRef struct {
+	ID   string
+	Name string
+}
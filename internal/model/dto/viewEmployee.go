@@ -0,0 +1,22 @@
+package dto
+
+type ViewEmployee struct {
+	ID          string
+	Name        string
+	Surname     string
+	BirthYear   uint16
+	Manager     *EmployeeRef
+	Departments []ViewEmployeeDepartment
+	Version     int
+}
+
+type ViewEmployeeDepartment struct {
+	ID   string
+	Name string
+	Path string
+	// FullPath is human readable path like "Software department / Web department"
+	FullPath string
+	Position string
+	FTE      float64
+	Primary  bool
+}
@@ -0,0 +1,56 @@
+package dto
+
+import "time"
+
+// Statuses of webhook deliveries, dead ones ran out of attempts.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// CreateWebhook subscribes url to events, empty EventTypes means all of them.
+// Secret is used to sign request bodies.
+type CreateWebhook struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+type Webhook struct {
+	ID         string
+	URL        string
+	EventTypes []string
+	Active     bool
+	CreatedAt  time.Time
+}
+
+type ListDeliveries struct {
+	WebhookID string
+	Status    string
+	Limit     int
+	Offset    int
+}
+
+type WebhookDelivery struct {
+	WebhookID     string
+	EventID       int64
+	EventType     string
+	Status        string
+	Attempts      int
+	LastStatus    int
+	LastError     string
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time
+}
+
+// PendingDelivery is a delivery claimed by dispatcher with everything
+// needed to send it.
+type PendingDelivery struct {
+	WebhookID string
+	URL       string
+	Secret    string
+	Attempts  int
+	Event     Event
+}
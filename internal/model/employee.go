@@ -1,9 +1,23 @@
 package model
 
+// Employee reports to employee with ManagerID, nil if there is none.
+// Memberships hold positions of employee in listed departments.
 type Employee struct {
 	ID          string
 	Name        string
 	Surname     string
 	BirthYear   uint16
+	ManagerID   *string
+	Version     int
 	Departments []Department
+	Memberships []Membership
+}
+
+// Membership is position of employee in department, FTE is its share of
+// full time.
+type Membership struct {
+	DepartmentID string
+	Position     string
+	FTE          float64
+	Primary      bool
 }
@@ -0,0 +1,204 @@
+// Package orgchart draws department trees as Graphviz DOT or as SVG laid
+// out in pure Go, top down with parents centered above their children.
+package orgchart
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+)
+
+// DOT writes trees as digraph, departments are boxes labeled with member
+// count and employees are ellipses.
+func DOT(w io.Writer, roots []*dto.OrgNode) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph orgchart {\n")
+	bw.WriteString("\trankdir=TB;\n")
+	bw.WriteString("\tnode [fontname=\"Helvetica\", fontsize=10];\n")
+	var walk func(n *dto.OrgNode)
+	walk = func(n *dto.OrgNode) {
+		if n.Kind == dto.OrgNodeEmployee {
+			fmt.Fprintf(bw, "\t%s [shape=ellipse, label=%s];\n", dotString(n.ID), dotString(n.Name))
+		} else {
+			fmt.Fprintf(bw, "\t%s [shape=box, style=rounded, label=%s];\n",
+				dotString(n.ID), dotString(n.Name+"\n"+membersLabel(n.Members)))
+		}
+		for _, c := range n.Children {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", dotString(n.ID), dotString(c.ID))
+			walk(c)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// dotString quotes s as DOT string.
+func dotString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+func membersLabel(n int) string {
+	if n == 1 {
+		return "1 member"
+	}
+	return strconv.Itoa(n) + " members"
+}
+
+// layout sizes in pixels
+const (
+	charWidth  = 7
+	lineHeight = 14
+	padding    = 10
+	hGap       = 20
+	vGap       = 40
+	margin     = 20
+)
+
+// box is laid out node, x is its center and y its top.
+type box struct {
+	node     *dto.OrgNode
+	lines    []string
+	w, h     int
+	span     int
+	x, y     int
+	children []*box
+}
+
+func measure(n *dto.OrgNode) *box {
+	b := &box{node: n, lines: []string{n.Name}}
+	if n.Kind != dto.OrgNodeEmployee {
+		b.lines = append(b.lines, membersLabel(n.Members))
+	}
+	for _, l := range b.lines {
+		if w := utf8.RuneCountInString(l)*charWidth + 2*padding; w > b.w {
+			b.w = w
+		}
+	}
+	b.h = len(b.lines)*lineHeight + padding
+
+	childrenSpan := 0
+	for i, c := range n.Children {
+		cb := measure(c)
+		b.children = append(b.children, cb)
+		if i > 0 {
+			childrenSpan += hGap
+		}
+		childrenSpan += cb.span
+	}
+	b.span = b.w
+	if childrenSpan > b.span {
+		b.span = childrenSpan
+	}
+	return b
+}
+
+// place positions subtree of b within span starting at left, rowHeight is
+// height of tallest box, so rows are aligned.
+func place(b *box, left, depth, rowHeight int) {
+	b.x = left + b.span/2
+	b.y = margin + depth*(rowHeight+vGap)
+	childrenSpan := -hGap
+	for _, c := range b.children {
+		childrenSpan += c.span + hGap
+	}
+	cursor := left + (b.span-childrenSpan)/2
+	for _, c := range b.children {
+		place(c, cursor, depth+1, rowHeight)
+		cursor += c.span + hGap
+	}
+}
+
+func maxHeight(b *box) int {
+	h := b.h
+	for _, c := range b.children {
+		if ch := maxHeight(c); ch > h {
+			h = ch
+		}
+	}
+	return h
+}
+
+func depth(b *box) int {
+	d := 0
+	for _, c := range b.children {
+		if cd := depth(c) + 1; cd > d {
+			d = cd
+		}
+	}
+	return d
+}
+
+// SVG writes trees side by side as standalone svg document.
+func SVG(w io.Writer, roots []*dto.OrgNode) error {
+	boxes := make([]*box, 0, len(roots))
+	rowHeight, levels := 0, 0
+	for _, root := range roots {
+		b := measure(root)
+		boxes = append(boxes, b)
+		if h := maxHeight(b); h > rowHeight {
+			rowHeight = h
+		}
+		if d := depth(b) + 1; d > levels {
+			levels = d
+		}
+	}
+	width := margin
+	for _, b := range boxes {
+		place(b, width, 0, rowHeight)
+		width += b.span + hGap
+	}
+	width += margin - hGap
+	if len(boxes) == 0 {
+		width = 2 * margin
+	}
+	height := 2*margin + levels*rowHeight + (levels-1)*vGap
+	if levels == 0 {
+		height = 2 * margin
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`font-family="Helvetica, Arial, sans-serif" font-size="12">`+"\n", width, height, width, height)
+	var draw func(b *box)
+	draw = func(b *box) {
+		for _, c := range b.children {
+			// elbow from bottom of parent to top of child
+			mid := b.y + b.h + vGap/2
+			fmt.Fprintf(bw, `<path d="M%d %d V%d H%d V%d" fill="none" stroke="#888"/>`+"\n",
+				b.x, b.y+b.h, mid, c.x, c.y)
+		}
+		if b.node.Kind == dto.OrgNodeEmployee {
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="#f4f4f4" stroke="#999"/>`+"\n",
+				b.x-b.w/2, b.y, b.w, b.h, b.h/2)
+		} else {
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" rx="4" fill="#e8f0fe" stroke="#4a6fa5"/>`+"\n",
+				b.x-b.w/2, b.y, b.w, b.h)
+		}
+		for i, l := range b.lines {
+			weight := "normal"
+			if i == 0 && b.node.Kind != dto.OrgNodeEmployee {
+				weight = "bold"
+			}
+			fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle" font-weight="%s">%s</text>`+"\n",
+				b.x, b.y+padding/2+(i+1)*lineHeight-3, weight, html.EscapeString(l))
+		}
+		for _, c := range b.children {
+			draw(c)
+		}
+	}
+	for _, b := range boxes {
+		draw(b)
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
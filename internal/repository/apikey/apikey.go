@@ -0,0 +1,163 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/google/uuid"
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// tables
+	apiKeyTable = "api_keys"
+)
+
+type APIKeyRepo interface {
+	Create(ctx context.Context, req *dto.CreateAPIKey, prefix, hash, createdBy string) (dto.APIKey, error)
+	List(ctx context.Context) ([]dto.APIKey, error)
+	Delete(ctx context.Context, keyID string) error
+	GetByHash(ctx context.Context, hash string) (dto.APIKey, error)
+	GetByID(ctx context.Context, keyID string) (dto.APIKey, error)
+	Touch(ctx context.Context, keyID string) error
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func New(pool *pgxpool.Pool) *Repository {
+	return &Repository{db: pool}
+}
+
+var apiKeyColumns = []string{"api_key_id", "name", "key_prefix", "admin", "created_by", "created_at", "last_used_at"}
+
+func scanAPIKey(row pgx.Row) (dto.APIKey, error) {
+	k := dto.APIKey{}
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Admin, &k.CreatedBy, &k.CreatedAt, &k.LastUsedAt)
+	return k, err
+}
+
+// Create stores hash of key, the key itself is known only to the caller.
+func (r *Repository) Create(ctx context.Context, req *dto.CreateAPIKey, prefix, hash, createdBy string) (dto.APIKey, error) {
+	query, args, err := sq.
+		Insert(apiKeyTable).
+		Columns("api_key_id", "name", "key_prefix", "key_hash", "admin", "created_by").
+		Values(uuid.NewString(), req.Name, prefix, hash, req.Admin, createdBy).
+		Suffix("RETURNING api_key_id, name, key_prefix, admin, created_by, created_at, last_used_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.APIKey{}, fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	k, err := scanAPIKey(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		return k, apperror.FromDB(err, "can't create api key")
+	}
+	return k, nil
+}
+
+func (r *Repository) List(ctx context.Context) ([]dto.APIKey, error) {
+	keys := []dto.APIKey{}
+	query, args, err := sq.
+		Select(apiKeyColumns...).
+		From(apiKeyTable).
+		OrderBy("created_at", "api_key_id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return keys, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return keys, fmt.Errorf("can't select api keys: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, fmt.Errorf("can't scan api key: %s", err.Error())
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Delete revokes key, requests with it are rejected from now on.
+func (r *Repository) Delete(ctx context.Context, keyID string) error {
+	if _, err := uuid.Parse(keyID); err != nil {
+		return apperror.BadRequest("wrong api key id", err)
+	}
+	query, args, err := sq.
+		Delete(apiKeyTable).
+		Where(sq.Eq{"api_key_id": keyID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	tag, err := r.db.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't delete api key: %s", err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.NotFound("api key not found", nil)
+	}
+	return nil
+}
+
+func (r *Repository) GetByHash(ctx context.Context, hash string) (dto.APIKey, error) {
+	return r.get(ctx, sq.Eq{"key_hash": hash})
+}
+
+func (r *Repository) GetByID(ctx context.Context, keyID string) (dto.APIKey, error) {
+	if _, err := uuid.Parse(keyID); err != nil {
+		return dto.APIKey{}, apperror.NotFound("api key not found", err)
+	}
+	return r.get(ctx, sq.Eq{"api_key_id": keyID})
+}
+
+func (r *Repository) get(ctx context.Context, where sq.Eq) (dto.APIKey, error) {
+	query, args, err := sq.
+		Select(apiKeyColumns...).
+		From(apiKeyTable).
+		Where(where).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.APIKey{}, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	k, err := scanAPIKey(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return k, apperror.NotFound("api key not found", err)
+		}
+		return k, fmt.Errorf("can't scan api key: %w", err)
+	}
+	return k, nil
+}
+
+// Touch records use of key, at most once a minute so that every request
+// doesn't write a row.
+func (r *Repository) Touch(ctx context.Context, keyID string) error {
+	query, args, err := sq.
+		Update(apiKeyTable).
+		Set("last_used_at", sq.Expr("now()")).
+		Where(sq.Eq{"api_key_id": keyID}).
+		Where("(last_used_at IS NULL OR last_used_at < now() - interval '1 minute')").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	if _, err := r.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't touch api key: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/identity"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/pgutil"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// tables
+	auditTable = "audit_events"
+)
+
+// Actions written to audit log.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionMove   = "move"
+	ActionDelete = "delete"
+)
+
+// Event is a single change of entity, nil Before means the entity was
+// created and nil After means it was deleted.
+type Event struct {
+	Action   string
+	Entity   string
+	EntityID string
+	Before   interface{}
+	After    interface{}
+}
+
+// Department is audited state of department.
+type Department struct {
+	Name   string
+	Path   string
+	HeadID *string
+}
+
+// Employee is audited state of employee, Departments are sorted ids and
+// Memberships are positions in them by department id.
+type Employee struct {
+	Name        string
+	Surname     string
+	BirthYear   uint16
+	ManagerID   *string
+	Departments []string
+	Memberships map[string]Membership
+}
+
+// Membership is audited position of employee in department.
+type Membership struct {
+	Position string
+	FTE      float64
+	Primary  bool
+}
+
+// Change is a single field difference between states.
+type Change struct {
+	From interface{}
+	To   interface{}
+}
+
+type AuditRepo interface {
+	List(ctx context.Context, f *dto.ListAudit) ([]dto.AuditEvent, int, error)
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func New(pool *pgxpool.Pool) *Repository {
+	return &Repository{db: pool}
+}
+
+// Record writes event with actor from context, it must be called with the
+// transaction of the change itself.
+func Record(ctx context.Context, q pgutil.Querier, e Event) error {
+	before, err := toFields(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := toFields(e.After)
+	if err != nil {
+		return err
+	}
+
+	diff := make(map[string]interface{})
+	for k, v := range before {
+		if !reflect.DeepEqual(v, after[k]) {
+			diff[k] = Change{From: v, To: after[k]}
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok {
+			diff[k] = Change{To: v}
+		}
+	}
+
+	query, args, err := sq.
+		Insert(auditTable).
+		Columns("actor", "action", "entity", "entity_id", "before", "after", "diff").
+		Values(identity.Actor(ctx), e.Action, e.Entity, e.EntityID,
+			jsonOrNull(before), jsonOrNull(after), jsonOrNull(diff)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build query: %s", err.Error())
+	}
+	if _, err := q.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't write audit event: %s", err.Error())
+	}
+	return nil
+}
+
+// toFields converts state to map of its json fields.
+func toFields(state interface{}) (map[string]interface{}, error) {
+	if state == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal audit state: %s", err.Error())
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, fmt.Errorf("can't unmarshal audit state: %s", err.Error())
+	}
+	return fields, nil
+}
+
+// jsonOrNull marshals fields, empty ones are stored as NULL.
+func jsonOrNull(fields map[string]interface{}) []byte {
+	if len(fields) == 0 {
+		return nil
+	}
+	// map of json values can always be marshaled back
+	b, _ := json.Marshal(fields)
+	return b
+}
+
+// LoadEmployees reads audited state of employees by their ids.
+func LoadEmployees(ctx context.Context, q pgutil.Querier, employeeIDs []string) (map[string]Employee, error) {
+	states := make(map[string]Employee, len(employeeIDs))
+	if len(employeeIDs) == 0 {
+		return states, nil
+	}
+	sql := `SELECT e.employee_id, e.employee_name, e.employee_surname, e.employee_birthyear, e.manager_id,
+			coalesce(array_agg(ed.department_id::text) FILTER (WHERE ed.department_id IS NOT NULL), '{}'),
+			coalesce(jsonb_object_agg(ed.department_id::text, jsonb_build_object(
+				'Position', ed.position, 'FTE', ed.fte, 'Primary', ed.is_primary))
+				FILTER (WHERE ed.department_id IS NOT NULL), '{}')
+		FROM employees e
+		LEFT JOIN employee_department ed ON ed.employee_id = e.employee_id AND ed.valid_to IS NULL
+		WHERE e.employee_id = ANY($1::uuid[])
+		GROUP BY e.employee_id`
+	rows, err := q.Query(ctx, sql, employeeIDs)
+	if err != nil {
+		return states, fmt.Errorf("can't select employees: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		state := Employee{}
+		if err := rows.Scan(&id, &state.Name, &state.Surname, &state.BirthYear, &state.ManagerID, &state.Departments,
+			&state.Memberships); err != nil {
+			return states, fmt.Errorf("can't scan employee: %s", err.Error())
+		}
+		sort.Strings(state.Departments)
+		states[id] = state
+	}
+	return states, rows.Err()
+}
+
+func (r *Repository) List(ctx context.Context, f *dto.ListAudit) ([]dto.AuditEvent, int, error) {
+	events := []dto.AuditEvent{}
+	filters := sq.And{}
+	if f.Entity != "" {
+		filters = append(filters, sq.Eq{"entity": f.Entity})
+	}
+	if f.EntityID != "" {
+		filters = append(filters, sq.Eq{"entity_id": f.EntityID})
+	}
+	if !f.Since.IsZero() {
+		filters = append(filters, sq.GtOrEq{"created_at": f.Since})
+	}
+
+	query, args, err := sq.
+		Select("count(*)").
+		From(auditTable).
+		Where(filters).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return events, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	var total int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return events, 0, fmt.Errorf("can't count audit events: %s", err.Error())
+	}
+
+	b := sq.
+		Select("event_id", "actor", "action", "entity", "entity_id", "before", "after", "diff", "created_at").
+		From(auditTable).
+		Where(filters).
+		OrderBy("created_at DESC", "event_id DESC")
+	query, args, err = pgutil.Paginate(b, f.Limit, f.Offset).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return events, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return events, 0, fmt.Errorf("can't select audit events: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := dto.AuditEvent{}
+		var before, after, diff []byte
+		err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &before, &after, &diff, &e.CreatedAt)
+		if err != nil {
+			return events, 0, fmt.Errorf("can't scan audit event: %s", err.Error())
+		}
+		e.Before, e.After, e.Diff = before, after, diff
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return events, 0, fmt.Errorf("can't select audit events: %s", err.Error())
+	}
+	return events, total, nil
+}
@@ -5,10 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
 	"github.com/dimashiro/test_mediasoft/internal/model"
 	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/audit"
+	"github.com/dimashiro/test_mediasoft/internal/repository/outbox"
+	"github.com/dimashiro/test_mediasoft/internal/repository/pgutil"
 	"github.com/google/uuid"
 	pgx "github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -16,16 +21,25 @@ import (
 
 const (
 	// tables
-	departmentTable = "departments"
+	departmentTable         = "departments"
+	employeeDepartmentTable = "employee_department"
 )
 
 type DepartmentRepo interface {
 	GetByID(ctx context.Context, departmentID string) (model.Department, error)
 	Create(ctx context.Context, dto *dto.CreateDepartment) (model.Department, error)
 	Update(ctx context.Context, dto *dto.UpdateDepartment) error
-	Hierarchy(ctx context.Context) (map[string]*model.Department, error)
-	GetAll(ctx context.Context) ([]dto.ViewAllDepartments, error)
-	Delete(ctx context.Context, dto *dto.DeleteDepartment) error
+	Move(ctx context.Context, dto *dto.MoveDepartment) error
+	Hierarchy(ctx context.Context) (model.Hierarchy, error)
+	GetAll(ctx context.Context, f *dto.ListDepartments, departmentIDs []string) ([]dto.ViewAllDepartments, int, error)
+	GetViewByID(ctx context.Context, departmentID string) (dto.ViewAllDepartments, error)
+	GetChildren(ctx context.Context, dp model.Department) ([]dto.ViewAllDepartments, error)
+	Ancestors(ctx context.Context, dp model.Department) ([]model.Department, error)
+	Delete(ctx context.Context, dto *dto.DeleteDepartment) (dto.DeleteDepartmentResult, error)
+	Export(ctx context.Context, departmentIDs []string, fn func(dto.DepartmentExportRow) error) error
+	MemberCounts(ctx context.Context, subtreePaths []string) (map[string]int, error)
+	Subtree(ctx context.Context, dp model.Department, depth int) (*model.Department, error)
+	RepairPaths(ctx context.Context, dryRun bool) (RepairResult, error)
 }
 
 type Repository struct {
@@ -38,8 +52,11 @@ func New(pool *pgxpool.Pool) *Repository {
 
 func (r *Repository) GetByID(ctx context.Context, departmentID string) (model.Department, error) {
 	dp := model.Department{}
+	if _, err := uuid.Parse(departmentID); err != nil {
+		return dp, apperror.BadRequest("wrong department id", err)
+	}
 	query, args, err := sq.
-		Select("department_id", "department_name", "department_path").
+		Select("department_id", "department_name", "department_path", "head_id", "version").
 		From(departmentTable).
 		Where(sq.Eq{"department_id": departmentID}).
 		PlaceholderFormat(sq.Dollar).
@@ -48,8 +65,11 @@ func (r *Repository) GetByID(ctx context.Context, departmentID string) (model.De
 		return dp, fmt.Errorf("can't build query: %s", err.Error())
 	}
 	err = r.db.QueryRow(ctx, query, args...).
-		Scan(&dp.ID, &dp.Name, &dp.Path)
+		Scan(&dp.ID, &dp.Name, &dp.Path, &dp.HeadID, &dp.Version)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dp, apperror.NotFound("department not found", err)
+		}
 		return dp, fmt.Errorf("can't scan department: %w", err)
 	}
 
@@ -57,16 +77,24 @@ func (r *Repository) GetByID(ctx context.Context, departmentID string) (model.De
 }
 
 func (r *Repository) Create(ctx context.Context, dto *dto.CreateDepartment) (model.Department, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return model.Department{}, fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
 	dpParent := model.Department{}
 	//TODO move to validation later
 	if dto.ParentID != "" {
 		if _, err := uuid.Parse(dto.ParentID); err == nil {
-			dpParent, err = r.GetByID(ctx, dto.ParentID)
+			// shared lock lets siblings be created at once, but waits for
+			// moves that rewrite path of parent
+			dpParent, err = getForShare(ctx, tx, dto.ParentID)
 			if err != nil {
-				return model.Department{}, fmt.Errorf("parent not found: %s", err.Error())
+				return model.Department{}, apperror.Wrap(err, "parent not found")
 			}
 		} else {
-			return model.Department{}, fmt.Errorf("wrond parent id: %s", err.Error())
+			return model.Department{}, apperror.BadRequest("wrong parent id", err)
 		}
 	}
 	uuid := GenerateID()
@@ -75,15 +103,25 @@ func (r *Repository) Create(ctx context.Context, dto *dto.CreateDepartment) (mod
 		path = path + "."
 	}
 
-	path = path + strings.ReplaceAll(uuid, "-", "_")
+	path = path + pathLabel(uuid)
+	var parentID interface{}
+	if dpParent.ID != "" {
+		parentID = dpParent.ID
+	}
+	headID, err := lockHead(ctx, tx, dto.HeadID)
+	if err != nil {
+		return model.Department{}, err
+	}
 	query, args, err := sq.
 		Insert(departmentTable).
-		Columns("department_id", "department_name", "department_path").
+		Columns("department_id", "department_name", "department_path", "parent_id", "head_id").
 		Values(
 			uuid,
 			dto.Name,
 			path,
-		).Suffix("RETURNING *").
+			parentID,
+			headID,
+		).Suffix("RETURNING department_id, department_name, department_path, head_id, version").
 		PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return model.Department{}, fmt.Errorf("can't build sql: %s", err.Error())
@@ -91,10 +129,18 @@ func (r *Repository) Create(ctx context.Context, dto *dto.CreateDepartment) (mod
 
 	// insert into departments table.
 	var newDepartment model.Department
-	err = r.db.QueryRow(ctx, query, args...).
-		Scan(&newDepartment.ID, &newDepartment.Name, &newDepartment.Path)
+	err = tx.QueryRow(ctx, query, args...).
+		Scan(&newDepartment.ID, &newDepartment.Name, &newDepartment.Path, &newDepartment.HeadID, &newDepartment.Version)
 	if err != nil {
-		return model.Department{}, fmt.Errorf("can't scan department: %w", err)
+		return model.Department{}, apperror.FromDB(err, "can't create department")
+	}
+
+	if err := recordDepartment(ctx, tx, audit.ActionCreate, nil, &newDepartment); err != nil {
+		return model.Department{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.Department{}, fmt.Errorf("can't commit tx: %s", err.Error())
 	}
 
 	return newDepartment, nil
@@ -102,98 +148,594 @@ func (r *Repository) Create(ctx context.Context, dto *dto.CreateDepartment) (mod
 
 func (r *Repository) Update(ctx context.Context, dto *dto.UpdateDepartment) error {
 	//TODO move to validation later
-	dp := model.Department{}
-	if _, err := uuid.Parse(dto.ID); err == nil {
-		dp, err = r.GetByID(ctx, dto.ID)
-		if err != nil {
-			return fmt.Errorf("department not found: %s", err.Error())
-		}
+	if _, err := uuid.Parse(dto.ID); err != nil {
+		return apperror.BadRequest("wrong id", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	dp, err := getForUpdate(ctx, tx, dto.ID)
+	if err != nil {
+		return apperror.Wrap(err, "department not found")
+	}
+	if err := checkVersion(dp, dto.Version); err != nil {
+		return err
 	}
 
-	dpParent := model.Department{}
-	//TODO move to validation later
 	if dto.ParentID != nil {
-		if _, err := uuid.Parse(*dto.ParentID); err == nil {
-			dpParent, err = r.GetByID(ctx, *dto.ParentID)
+		if err := moveSubtree(ctx, tx, dp, *dto.ParentID); err != nil {
+			return err
+		}
+	}
+
+	if dto.Name != nil || dto.HeadID != nil {
+		b := sq.
+			Update(departmentTable).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"department_id": dp.ID})
+		if dto.Name != nil {
+			b = b.Set("department_name", *dto.Name)
+		}
+		if dto.HeadID != nil {
+			headID, err := lockHead(ctx, tx, *dto.HeadID)
 			if err != nil {
-				return fmt.Errorf("parent not found: %s", err.Error())
+				return err
 			}
-		} else {
-			return fmt.Errorf("wrond parent id: %s", err.Error())
+			b = b.Set("head_id", headID)
 		}
-		dp.Path = dpParent.Path + "." + strings.ReplaceAll(dp.ID, "-", "_")
+		query, args, err := b.PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			return fmt.Errorf("can't build sql: %s", err.Error())
+		}
+
+		_, err = tx.Exec(ctx, query, args...)
+		if err != nil {
+			return apperror.FromDB(err, "can't update department")
+		}
+	}
+
+	updated, err := getForUpdate(ctx, tx, dp.ID)
+	if err != nil {
+		return err
+	}
+	if err := recordDepartment(ctx, tx, audit.ActionUpdate, &dp, &updated); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can't commit tx: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Move re-parents department together with its whole subtree.
+// Empty ParentID moves department to the root.
+func (r *Repository) Move(ctx context.Context, dto *dto.MoveDepartment) error {
+	if _, err := uuid.Parse(dto.ID); err != nil {
+		return apperror.BadRequest("wrong id", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	dp, err := getForUpdate(ctx, tx, dto.ID)
+	if err != nil {
+		return apperror.Wrap(err, "department not found")
+	}
+	if err := checkVersion(dp, dto.Version); err != nil {
+		return err
+	}
+
+	if err := moveSubtree(ctx, tx, dp, dto.ParentID); err != nil {
+		return err
+	}
+
+	moved, err := getForUpdate(ctx, tx, dp.ID)
+	if err != nil {
+		return err
+	}
+	if err := recordDepartment(ctx, tx, audit.ActionMove, &dp, &moved); err != nil {
+		return err
 	}
 
-	if dto.Name != nil {
-		dp.Name = *dto.Name
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can't commit tx: %s", err.Error())
 	}
 
+	return nil
+}
+
+// getForUpdate reads department and locks its row till the end of tx.
+func getForUpdate(ctx context.Context, tx pgx.Tx, departmentID string) (model.Department, error) {
+	return getLocked(ctx, tx, departmentID, "FOR UPDATE")
+}
+
+// getForShare reads department and keeps it from changes till the end of tx.
+func getForShare(ctx context.Context, tx pgx.Tx, departmentID string) (model.Department, error) {
+	return getLocked(ctx, tx, departmentID, "FOR SHARE")
+}
+
+func getLocked(ctx context.Context, tx pgx.Tx, departmentID, lock string) (model.Department, error) {
+	dp := model.Department{}
 	query, args, err := sq.
-		Update(departmentTable).
-		Set("department_name", dp.Name).
-		Set("department_path", dp.Path).
-		Where(sq.Eq{"department_id": dp.ID}).PlaceholderFormat(sq.Dollar).
+		Select("department_id", "department_name", "department_path", "head_id", "version").
+		From(departmentTable).
+		Where(sq.Eq{"department_id": departmentID}).
+		Suffix(lock).
+		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("can't build sql: %s", err.Error())
+		return dp, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	err = tx.QueryRow(ctx, query, args...).
+		Scan(&dp.ID, &dp.Name, &dp.Path, &dp.HeadID, &dp.Version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dp, apperror.NotFound("department not found", err)
+		}
+		return dp, fmt.Errorf("can't scan department: %w", err)
 	}
 
-	_, err = r.db.Exec(ctx, query, args...)
+	return dp, nil
+}
+
+// lockHead checks that employee heading department exists and keeps it
+// from being deleted till the end of tx. Empty headID means no head and
+// returns nil to store NULL.
+func lockHead(ctx context.Context, tx pgx.Tx, headID string) (interface{}, error) {
+	if headID == "" {
+		return nil, nil
+	}
+	if _, err := uuid.Parse(headID); err != nil {
+		return nil, apperror.BadRequest("wrong head id", err)
+	}
+	var id string
+	err := tx.QueryRow(ctx, "SELECT employee_id FROM employees WHERE employee_id = $1 FOR SHARE", headID).Scan(&id)
 	if err != nil {
-		return fmt.Errorf("sql exec err: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.NotFound("head not found", err)
+		}
+		return nil, fmt.Errorf("can't scan head: %w", err)
 	}
+	return id, nil
+}
 
+// lockSubtree locks descendants of department at path till the end of tx.
+// Departments created or memberships added under them concurrently wait for
+// tx, and rows committed before the locks were taken are seen by the next
+// statements of tx.
+func lockSubtree(ctx context.Context, tx pgx.Tx, path string) error {
+	sql := "SELECT department_id FROM departments WHERE department_path <@ $1 FOR UPDATE"
+	rows, err := tx.Query(ctx, sql, path)
+	if err != nil {
+		return apperror.FromDB(err, "can't lock subtree")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return apperror.FromDB(err, "can't lock subtree")
+	}
 	return nil
 }
 
-func (r *Repository) Hierarchy(ctx context.Context) (map[string]*model.Department, error) {
-	// var dps []model.Department
-	mDps := make(map[string]*model.Department)
+// moveSubtree rewrites paths of department and all its descendants so
+// that department becomes a child of parentID (or a root if parentID is empty).
+func moveSubtree(ctx context.Context, tx pgx.Tx, dp model.Department, parentID string) error {
+	newPath := pathLabel(dp.ID)
+	var newParentID interface{}
+	if parentID != "" {
+		if _, err := uuid.Parse(parentID); err != nil {
+			return apperror.BadRequest("wrong parent id", err)
+		}
+		dpParent, err := getForUpdate(ctx, tx, parentID)
+		if err != nil {
+			return apperror.Wrap(err, "parent not found")
+		}
+		if dpParent.Path == dp.Path || strings.HasPrefix(dpParent.Path, dp.Path+".") {
+			return apperror.Conflict("cannot move department into itself or its descendant", nil)
+		}
+		newPath = dpParent.Path + "." + newPath
+		newParentID = dpParent.ID
+	}
+
+	if newPath == dp.Path {
+		return nil
+	}
+	if err := lockSubtree(ctx, tx, dp.Path); err != nil {
+		return err
+	}
+
+	sql := `UPDATE departments SET department_path = CASE
+		WHEN department_path = $1::ltree THEN $2::ltree
+		ELSE $2::ltree || subpath(department_path, nlevel($1::ltree))
+	END, parent_id = CASE
+		WHEN department_path = $1::ltree THEN $3::uuid
+		ELSE parent_id
+	END, version = version + 1
+	WHERE department_path <@ $1::ltree`
+	_, err := tx.Exec(ctx, sql, dp.Path, newPath, newParentID)
+	if err != nil {
+		return apperror.FromDB(err, "can't move subtree")
+	}
+
+	return nil
+}
+
+// Export calls fn for every department ordered by full path. Rows are read
+// from the cursor one by one, so result is never loaded as a whole.
+func (r *Repository) Export(ctx context.Context, departmentIDs []string, fn func(dto.DepartmentExportRow) error) error {
+	b := sq.
+		Select("d.department_id", "d.department_name",
+			"coalesce(d.parent_id::text, '') AS parent_id",
+			pgutil.DepartmentFullPath+" AS full_path",
+			"nlevel(d.department_path) AS level",
+			`(SELECT count(*) FROM employee_department ed
+				WHERE ed.department_id = d.department_id AND ed.valid_to IS NULL) AS members`).
+		From(departmentTable + " AS d")
+	if departmentIDs != nil {
+		b = b.Where(inSubtrees(departmentIDs))
+	}
 	query, args, err := sq.
-		Select("department_id", "department_name", "department_path").
+		Select("department_id", "department_name", "parent_id", "full_path", "level", "members").
+		FromSelect(b, "x").
+		OrderBy("full_path", "department_id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't select departments: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := dto.DepartmentExportRow{}
+		if err := rows.Scan(&d.ID, &d.Name, &d.ParentID, &d.FullPath, &d.Level, &d.Members); err != nil {
+			return fmt.Errorf("can't scan department: %s", err.Error())
+		}
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("can't read departments: %s", err.Error())
+	}
+	return nil
+}
+
+// Subtree returns dp with descendants at most depth levels below it, zero
+// depth means all of them. Only the subtree is read.
+func (r *Repository) Subtree(ctx context.Context, dp model.Department, depth int) (*model.Department, error) {
+	b := sq.
+		Select("department_id", "department_name", "department_path", "head_id", "version").
 		From(departmentTable).
-		OrderBy("department_path").
+		Where(sq.Expr("department_path <@ ?", dp.Path)).
+		OrderBy("department_path")
+	if depth > 0 {
+		b = b.Where(sq.Expr("nlevel(department_path) <= nlevel(?) + ?", dp.Path, depth))
+	}
+	query, args, err := b.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("can't select subtree: %s", err.Error())
+	}
+	defer rows.Close()
+
+	// parents go before children in order of paths
+	byPath := make(map[string]*model.Department)
+	var root *model.Department
+	for rows.Next() {
+		d := &model.Department{Children: []*model.Department{}}
+		if err := rows.Scan(&d.ID, &d.Name, &d.Path, &d.HeadID, &d.Version); err != nil {
+			return nil, fmt.Errorf("can't scan department: %s", err.Error())
+		}
+		byPath[d.Path] = d
+		if d.Path == dp.Path {
+			root = d
+			continue
+		}
+		if i := strings.LastIndex(d.Path, "."); i >= 0 {
+			if parent, ok := byPath[d.Path[:i]]; ok {
+				parent.Children = append(parent.Children, d)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't read subtree: %s", err.Error())
+	}
+	if root == nil {
+		return nil, apperror.NotFound("department not found", nil)
+	}
+	return root, nil
+}
+
+// MemberCounts returns amount of current direct members by department id,
+// departments without members are absent. Non-nil subtreePaths limit counts
+// to departments of these subtrees.
+func (r *Repository) MemberCounts(ctx context.Context, subtreePaths []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	b := sq.
+		Select("ed.department_id", "count(*)").
+		From(employeeDepartmentTable + " AS ed").
+		Where("ed.valid_to IS NULL").
+		GroupBy("ed.department_id")
+	if subtreePaths != nil {
+		b = b.Join(departmentTable + " AS d ON d.department_id = ed.department_id").
+			Where(sq.Expr("d.department_path <@ ?::text[]::ltree[]", subtreePaths))
+	}
+	query, args, err := b.
+		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return mDps, fmt.Errorf("can't build query: %s", err.Error())
+		return counts, fmt.Errorf("can't build query: %s", err.Error())
 	}
 	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return mDps, fmt.Errorf("can't select departments: %s", err.Error())
+		return counts, fmt.Errorf("can't count members: %s", err.Error())
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		dp := model.Department{Children: []*model.Department{}}
-		err := rows.Scan(&dp.ID, &dp.Name, &dp.Path)
-		if err != nil {
-			return mDps, fmt.Errorf("can't scan department: %s", err.Error())
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return counts, fmt.Errorf("can't scan member count: %s", err.Error())
+		}
+		counts[id] = n
+	}
+	return counts, nil
+}
+
+// Hierarchy assembles all departments into trees by their parent ids, so
+// rows may come in any order. Departments whose path doesn't match path of
+// their parent are reported as orphans, RepairPaths recomputes such paths.
+// Departments that can't be reached from any root because of a cycle of
+// parent ids are orphans too and aren't linked at all.
+func (r *Repository) Hierarchy(ctx context.Context) (model.Hierarchy, error) {
+	h := model.Hierarchy{
+		Departments: make(map[string]*model.Department),
+		Roots:       []*model.Department{},
+		Orphans:     []*model.Department{},
+	}
+	query, args, err := sq.
+		Select("department_id", "department_name", "department_path", "head_id", "version", "coalesce(parent_id::text, '')").
+		From(departmentTable).
+		OrderBy("department_path", "department_id").
+		ToSql()
+	if err != nil {
+		return h, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return h, fmt.Errorf("can't select departments: %s", err.Error())
+	}
+	defer rows.Close()
+
+	dps := []*model.Department{}
+	parents := make(map[string]string)
+	for rows.Next() {
+		dp := &model.Department{Children: []*model.Department{}}
+		var parentID string
+		if err := rows.Scan(&dp.ID, &dp.Name, &dp.Path, &dp.HeadID, &dp.Version, &parentID); err != nil {
+			return h, fmt.Errorf("can't scan department: %s", err.Error())
+		}
+		h.Departments[dp.ID] = dp
+		parents[dp.ID] = parentID
+		dps = append(dps, dp)
+	}
+	if err := rows.Err(); err != nil {
+		return h, fmt.Errorf("can't read departments: %s", err.Error())
+	}
+	linkHierarchy(&h, dps, parents)
+	return h, nil
+}
+
+// linkHierarchy links departments of h in order of dps to their parents
+// once all of them are read.
+func linkHierarchy(h *model.Hierarchy, dps []*model.Department, parents map[string]string) {
+	children := make(map[string][]string)
+	reachable := make(map[string]bool)
+	queue := []string{}
+	for _, dp := range dps {
+		if _, ok := h.Departments[parents[dp.ID]]; ok {
+			children[parents[dp.ID]] = append(children[parents[dp.ID]], dp.ID)
+		} else {
+			reachable[dp.ID] = true
+			queue = append(queue, dp.ID)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			if !reachable[child] {
+				reachable[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	for _, dp := range dps {
+		// linked cycle would make endless trees
+		if !reachable[dp.ID] {
+			h.Orphans = append(h.Orphans, dp)
+			continue
+		}
+		expected := pathLabel(dp.ID)
+		if parent, ok := h.Departments[parents[dp.ID]]; ok {
+			parent.Children = append(parent.Children, dp)
+			expected = parent.Path + "." + expected
+		} else {
+			h.Roots = append(h.Roots, dp)
 		}
-		mDps[dp.ID] = &dp
-		if dp.Path != strings.ReplaceAll(dp.ID, "-", "_") {
-			parentID := strings.ReplaceAll(dp.Path[len(dp.Path)-73:len(dp.Path)-37], "_", "-")
-			pDp := mDps[parentID]
-			pDp.Children = append(pDp.Children, &dp)
+		if dp.Path != expected {
+			h.Orphans = append(h.Orphans, dp)
 		}
-		// dps = append(dps, dp)
 	}
-	return mDps, nil
 }
 
-func (r *Repository) GetAll(ctx context.Context) ([]dto.ViewAllDepartments, error) {
-	var dps []dto.ViewAllDepartments
+// PathFix is path of department rewritten by RepairPaths.
+type PathFix struct {
+	ID     string
+	Name   string
+	Before string
+	After  string
+}
+
+// RepairResult lists rewritten paths and departments that can't be reached
+// from any root by parent ids, which means a cycle of parents.
+type RepairResult struct {
+	Fixed       []PathFix
+	Unreachable []string
+}
 
-	sql := `select
-	d.department_id,
-    d.department_name,
-	(select count(*) from employee_department ed 
-	    where ed.department_id=d.department_id) as count_empl,
-	(select count(*) from employee_department ed 
-	    where ed.department_id in (select d1.department_id from departments d1 where d1.department_path <@ d.department_path)) as count_with_child_empl
-	from departments d
-	order by d.department_name`
+// repairedPaths computes path of every department reachable from roots by
+// parent ids.
+const repairedPaths = `WITH RECURSIVE tree AS (
+		SELECT department_id, text2ltree(replace(department_id::text, '-', '_')) AS path
+		FROM departments WHERE parent_id IS NULL
+		UNION ALL
+		SELECT d.department_id, t.path || text2ltree(replace(d.department_id::text, '-', '_'))
+		FROM departments d JOIN tree t ON d.parent_id = t.department_id
+	)`
+
+// RepairPaths recomputes paths of departments from their parent ids and
+// rewrites the ones that differ, nothing is saved on dry run.
+func (r *Repository) RepairPaths(ctx context.Context, dryRun bool) (RepairResult, error) {
+	res := RepairResult{Fixed: []PathFix{}, Unreachable: []string{}}
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return res, fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	// nobody changes departments while paths are rewritten
+	if _, err := tx.Exec(ctx, "LOCK TABLE departments IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return res, fmt.Errorf("can't lock departments: %s", err.Error())
+	}
+
+	rows, err := tx.Query(ctx, repairedPaths+`
+		SELECT department_id::text FROM departments
+		WHERE department_id NOT IN (SELECT department_id FROM tree)
+		ORDER BY department_id`)
+	if err != nil {
+		return res, fmt.Errorf("can't select unreachable departments: %s", err.Error())
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("can't scan department id: %s", err.Error())
+		}
+		res.Unreachable = append(res.Unreachable, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, fmt.Errorf("can't select unreachable departments: %s", err.Error())
+	}
 
-	rows, err := r.db.Query(ctx, sql)
+	rows, err = tx.Query(ctx, repairedPaths+`,
+	fixed AS (
+		SELECT t.department_id, d.department_path AS before, t.path AS after
+		FROM tree t JOIN departments d USING (department_id)
+		WHERE d.department_path IS DISTINCT FROM t.path
+	)
+	UPDATE departments d SET department_path = f.after, version = d.version + 1
+	FROM fixed f WHERE d.department_id = f.department_id
+	RETURNING d.department_id, d.department_name, coalesce(f.before::text, ''), f.after::text`)
+	if err != nil {
+		return res, apperror.FromDB(err, "can't repair paths")
+	}
+	for rows.Next() {
+		f := PathFix{}
+		if err := rows.Scan(&f.ID, &f.Name, &f.Before, &f.After); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("can't scan department: %s", err.Error())
+		}
+		res.Fixed = append(res.Fixed, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, apperror.FromDB(err, "can't repair paths")
+	}
+
+	for _, f := range res.Fixed {
+		before := model.Department{ID: f.ID, Name: f.Name, Path: f.Before}
+		after := model.Department{ID: f.ID, Name: f.Name, Path: f.After}
+		if err := recordDepartment(ctx, tx, audit.ActionUpdate, &before, &after); err != nil {
+			return res, err
+		}
+	}
+
+	if dryRun {
+		return res, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return res, fmt.Errorf("can't commit tx: %s", err.Error())
+	}
+	return res, nil
+}
+
+// inSubtrees limits departments aliased as d to subtrees of departmentIDs.
+func inSubtrees(departmentIDs []string) sq.Sqlizer {
+	return sq.Expr(`EXISTS (SELECT 1 FROM departments s_root
+		WHERE s_root.department_id = ANY(?::uuid[]) AND d.department_path <@ s_root.department_path)`, departmentIDs)
+}
+
+var departmentSortColumns = map[string]string{
+	"name": "d.department_name",
+}
+
+// viewSelect selects departments aliased as d with counts of memberships
+// valid at asOf, distinct counts members of several departments of
+// hierarchy once.
+func viewSelect(asOf time.Time, distinct bool) sq.SelectBuilder {
+	inHierarchy := "count(*)"
+	if distinct {
+		inHierarchy = "count(DISTINCT ed.employee_id)"
+	}
+	return sq.
+		Select("d.department_id", "d.department_name").
+		Column(sq.Expr(`(select count(*) from employee_department ed
+				where ed.department_id=d.department_id and ?) as count_empl`, pgutil.MembershipAt("ed", asOf))).
+		Column(sq.Expr(`(select `+inHierarchy+` from employee_department ed
+				where ed.department_id in (select d1.department_id from departments d1 where d1.department_path <@ d.department_path)
+				and ?) as count_with_child_empl`, pgutil.MembershipAt("ed", asOf))).
+		From(departmentTable + " AS d")
+}
+
+// withFTE adds sums of FTE shares of memberships valid at asOf to view select.
+func withFTE(b sq.SelectBuilder, asOf time.Time) sq.SelectBuilder {
+	return b.
+		Column(sq.Expr(`(select coalesce(sum(ed.fte), 0) from employee_department ed
+				where ed.department_id=d.department_id and ?) as fte_empl`, pgutil.MembershipAt("ed", asOf))).
+		Column(sq.Expr(`(select coalesce(sum(ed.fte), 0) from employee_department ed
+				where ed.department_id in (select d1.department_id from departments d1 where d1.department_path <@ d.department_path)
+				and ?) as fte_with_child_empl`, pgutil.MembershipAt("ed", asOf)))
+}
+
+// selectViews reads departments selected by b, weighted means that b has
+// columns added by withFTE.
+func (r *Repository) selectViews(ctx context.Context, b sq.SelectBuilder, weighted bool) ([]dto.ViewAllDepartments, error) {
+	dps := []dto.ViewAllDepartments{}
+	query, args, err := b.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return dps, fmt.Errorf("can't build query: %s", err.Error())
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return dps, fmt.Errorf("can't select departments: %s", err.Error())
 	}
@@ -201,8 +743,12 @@ func (r *Repository) GetAll(ctx context.Context) ([]dto.ViewAllDepartments, erro
 
 	for rows.Next() {
 		dp := dto.ViewAllDepartments{}
-		err := rows.Scan(&dp.ID, &dp.Name, &dp.EmployeesAmount, &dp.EmployeesAmountInHierarchy)
-		if err != nil {
+		dest := []interface{}{&dp.ID, &dp.Name, &dp.EmployeesAmount, &dp.EmployeesAmountInHierarchy}
+		if weighted {
+			dp.FTEAmount, dp.FTEAmountInHierarchy = new(float64), new(float64)
+			dest = append(dest, dp.FTEAmount, dp.FTEAmountInHierarchy)
+		}
+		if err := rows.Scan(dest...); err != nil {
 			return dps, fmt.Errorf("can't scan department: %s", err.Error())
 		}
 		dps = append(dps, dp)
@@ -210,43 +756,371 @@ func (r *Repository) GetAll(ctx context.Context) ([]dto.ViewAllDepartments, erro
 	return dps, nil
 }
 
-func (r *Repository) Delete(ctx context.Context, dto *dto.DeleteDepartment) error {
-	dp := model.Department{}
-	if _, err := uuid.Parse(dto.ID); err == nil {
-		dp, err = r.GetByID(ctx, dto.ID)
-		if err != nil {
-			return fmt.Errorf("department not found: %s", err.Error())
+// GetAll returns page of departments matching f, non-nil departmentIDs
+// limit them to subtrees of these departments.
+func (r *Repository) GetAll(ctx context.Context, f *dto.ListDepartments, departmentIDs []string) ([]dto.ViewAllDepartments, int, error) {
+	filters := sq.And{}
+	if f.NamePrefix != "" {
+		filters = append(filters, sq.ILike{"d.department_name": pgutil.LikePrefix(f.NamePrefix)})
+	}
+	if departmentIDs != nil {
+		filters = append(filters, inSubtrees(departmentIDs))
+	}
+
+	query, args, err := sq.
+		Select("count(*)").
+		From(departmentTable + " AS d").
+		Where(filters).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return []dto.ViewAllDepartments{}, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	var total int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return []dto.ViewAllDepartments{}, 0, fmt.Errorf("can't count departments: %s", err.Error())
+	}
+
+	order := pgutil.OrderBy(f.Sort, departmentSortColumns, "d.department_name ASC") + ", d.department_id ASC"
+	b := viewSelect(f.AsOf, f.Distinct)
+	weighted := f.Weight == dto.WeightFTE
+	if weighted {
+		b = withFTE(b, f.AsOf)
+	}
+	dps, err := r.selectViews(ctx, pgutil.Paginate(b.Where(filters).OrderBy(order), f.Limit, f.Offset), weighted)
+	if err != nil {
+		return dps, 0, err
+	}
+	return dps, total, nil
+}
+
+// GetViewByID returns department with its member counts.
+func (r *Repository) GetViewByID(ctx context.Context, departmentID string) (dto.ViewAllDepartments, error) {
+	dps, err := r.selectViews(ctx, viewSelect(time.Time{}, false).Where(sq.Eq{"d.department_id": departmentID}), false)
+	if err != nil {
+		return dto.ViewAllDepartments{}, err
+	}
+	if len(dps) == 0 {
+		return dto.ViewAllDepartments{}, apperror.NotFound("department not found", nil)
+	}
+	return dps[0], nil
+}
+
+// GetChildren returns direct children of department with their member counts.
+func (r *Repository) GetChildren(ctx context.Context, dp model.Department) ([]dto.ViewAllDepartments, error) {
+	return r.selectViews(ctx, viewSelect(time.Time{}, false).
+		Where(sq.Expr("d.department_path <@ ? AND nlevel(d.department_path) = nlevel(?) + 1", dp.Path, dp.Path)).
+		OrderBy("d.department_name", "d.department_id"), false)
+}
+
+// Ancestors returns chain of departments from the root down to dp itself.
+func (r *Repository) Ancestors(ctx context.Context, dp model.Department) ([]model.Department, error) {
+	dps := []model.Department{}
+	query, args, err := sq.
+		Select("department_id", "department_name", "department_path", "head_id", "version").
+		From(departmentTable).
+		Where(sq.Expr("department_path @> ?", dp.Path)).
+		OrderBy("nlevel(department_path)").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dps, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return dps, fmt.Errorf("can't select ancestors: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := model.Department{}
+		if err := rows.Scan(&a.ID, &a.Name, &a.Path, &a.HeadID, &a.Version); err != nil {
+			return dps, fmt.Errorf("can't scan department: %s", err.Error())
 		}
-	} else {
-		return fmt.Errorf("wrong id: %s", err.Error())
+		dps = append(dps, a)
+	}
+	return dps, nil
+}
+
+func (r *Repository) Delete(ctx context.Context, req *dto.DeleteDepartment) (dto.DeleteDepartmentResult, error) {
+	res := dto.DeleteDepartmentResult{DryRun: req.DryRun, Strategy: req.Strategy}
+	if _, err := uuid.Parse(req.ID); err != nil {
+		return res, apperror.BadRequest("wrong id", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return res, fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	dp, err := getForUpdate(ctx, tx, req.ID)
+	if err != nil {
+		return res, apperror.Wrap(err, "department not found")
+	}
+	if err := checkVersion(dp, req.Version); err != nil {
+		return res, err
+	}
+	// memberships can be added to any department of the subtree meanwhile,
+	// locked rows make them wait until the subtree is gone
+	if err := lockSubtree(ctx, tx, dp.Path); err != nil {
+		return res, err
 	}
 
 	sql := "SELECT department_path FROM departments WHERE department_path <@ $1 AND department_path != $1 LIMIT 1"
 	var dpPath string
-	err := r.db.QueryRow(ctx, sql, dp.Path).Scan(&dpPath)
-	if err == nil {
-		return errors.New("cannot delete department with descendants")
-	} else {
+	hasDescendants := true
+	err = tx.QueryRow(ctx, sql, dp.Path).Scan(&dpPath)
+	if err != nil {
 		if !errors.Is(err, pgx.ErrNoRows) {
-			return fmt.Errorf("query error: %s", err.Error())
+			return res, fmt.Errorf("query error: %s", err.Error())
+		}
+		hasDescendants = false
+	}
+
+	var memberIDs []string
+	if req.Strategy != "" {
+		// memberships of employees change, so do their versions
+		memberIDs, err = touchMembers(ctx, tx, dp, req.Strategy == dto.DeleteStrategyCascade)
+		if err != nil {
+			return res, err
+		}
+	}
+	membersBefore, err := audit.LoadEmployees(ctx, tx, memberIDs)
+	if err != nil {
+		return res, err
+	}
+
+	switch req.Strategy {
+	case "":
+		if hasDescendants {
+			return res, apperror.HasDescendants("cannot delete department with descendants")
+		}
+		hasMembers, err := hasMembers(ctx, tx, dp.ID)
+		if err != nil {
+			return res, err
+		}
+		if hasMembers {
+			return res, apperror.Constraint("cannot delete department with members", nil)
+		}
+	case dto.DeleteStrategyCascade:
+		// memberships of the whole subtree end together with departments
+		n, err := closeMemberships(ctx, tx, dp.Path, true)
+		if err != nil {
+			return res, err
+		}
+		res.DeletedMemberships = n
+	case dto.DeleteStrategyReparent:
+		sql = `UPDATE departments SET department_path = CASE
+			WHEN nlevel($1::ltree) = 1 THEN subpath(department_path, 1)
+			ELSE subpath(department_path, 0, nlevel($1::ltree) - 1) || subpath(department_path, nlevel($1::ltree))
+		END, parent_id = CASE
+			WHEN parent_id = $2::uuid THEN (SELECT p.parent_id FROM departments p WHERE p.department_id = $2::uuid)
+			ELSE parent_id
+		END, version = version + 1
+		WHERE department_path <@ $1::ltree AND department_path != $1::ltree`
+		tag, err := tx.Exec(ctx, sql, dp.Path, dp.ID)
+		if err != nil {
+			return res, apperror.FromDB(err, "can't reparent descendants")
+		}
+		res.ReparentedDepartments = int(tag.RowsAffected())
+	case dto.DeleteStrategyReassign:
+		if _, err := uuid.Parse(req.TargetID); err != nil {
+			return res, apperror.BadRequest("wrong target id", err)
+		}
+		if req.TargetID == dp.ID {
+			return res, apperror.BadRequest("cannot reassign members to deleted department", nil)
+		}
+		// only members are moved, children would be left without parent
+		if hasDescendants {
+			return res, apperror.HasDescendants("cannot reassign department with descendants, use reparent or cascade strategy")
+		}
+		if _, err := getForUpdate(ctx, tx, req.TargetID); err != nil {
+			return res, apperror.Wrap(err, "target department not found")
+		}
+		// positions are carried over but not primary flags, members may
+		// have another primary membership
+		sql = `INSERT INTO employee_department (employee_id, department_id, position, fte)
+			SELECT employee_id, $2, position, fte FROM employee_department WHERE department_id = $1 AND valid_to IS NULL
+			ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(ctx, sql, dp.ID, req.TargetID); err != nil {
+			return res, apperror.FromDB(err, "can't reassign memberships")
+		}
+	default:
+		return res, apperror.BadRequest("unknown delete strategy: "+req.Strategy, nil)
+	}
+
+	if req.Strategy != "" {
+		// remaining memberships of department itself
+		n, err := closeMemberships(ctx, tx, dp.Path, false)
+		if err != nil {
+			return res, err
+		}
+		if req.Strategy == dto.DeleteStrategyReassign {
+			res.ReassignedMemberships = n
+		} else {
+			res.DeletedMemberships += n
 		}
 	}
 
 	query, args, err := sq.
 		Delete(departmentTable).
-		Where(sq.Eq{"department_id": dto.ID}).
+		Where(sq.Expr("department_path <@ ?", dp.Path)).
+		Suffix("RETURNING department_id, department_name, department_path, head_id").
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("can't build query: %s", err.Error())
+		return res, fmt.Errorf("can't build query: %s", err.Error())
 	}
-	_, err = r.db.Exec(ctx, query, args...)
+	rows, err := tx.Query(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("sql exec err: %w", err)
+		return res, apperror.FromDB(err, "can't delete department")
 	}
-	return nil
+	deleted := []model.Department{}
+	for rows.Next() {
+		d := model.Department{}
+		if err := rows.Scan(&d.ID, &d.Name, &d.Path, &d.HeadID); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("can't scan department: %s", err.Error())
+		}
+		deleted = append(deleted, d)
+		res.DeletedDepartments = append(res.DeletedDepartments, d.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, apperror.FromDB(err, "can't delete department")
+	}
+
+	for i := range deleted {
+		if err := recordDepartment(ctx, tx, audit.ActionDelete, &deleted[i], nil); err != nil {
+			return res, err
+		}
+	}
+	membersAfter, err := audit.LoadEmployees(ctx, tx, memberIDs)
+	if err != nil {
+		return res, err
+	}
+	for _, id := range memberIDs {
+		err := audit.Record(ctx, tx, audit.Event{
+			Action:   audit.ActionUpdate,
+			Entity:   dto.AuditEntityEmployee,
+			EntityID: id,
+			Before:   membersBefore[id],
+			After:    membersAfter[id],
+		})
+		if err != nil {
+			return res, err
+		}
+		err = outbox.MembershipChanged(ctx, tx, id, membersBefore[id].Departments, membersAfter[id].Departments)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	if req.DryRun {
+		return res, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return res, fmt.Errorf("can't commit tx: %s", err.Error())
+	}
+	return res, nil
 }
 
 func GenerateID() string {
 	return uuid.NewString()
 }
+
+// touchMembers bumps versions of employees whose memberships are changed by
+// deletion of department (and its subtree if withSubtree) and returns their ids.
+func touchMembers(ctx context.Context, tx pgx.Tx, dp model.Department, withSubtree bool) ([]string, error) {
+	ids := []string{}
+	sql := `UPDATE employees SET version = version + 1 WHERE employee_id IN
+		(SELECT ed.employee_id FROM employee_department ed
+			JOIN departments d USING (department_id)
+			WHERE ed.valid_to IS NULL AND (d.department_id = $1 OR ($2 AND d.department_path <@ $3)))
+		RETURNING employee_id`
+	rows, err := tx.Query(ctx, sql, dp.ID, withSubtree, dp.Path)
+	if err != nil {
+		return ids, apperror.FromDB(err, "can't update employees")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return ids, fmt.Errorf("can't scan employee id: %s", err.Error())
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return ids, apperror.FromDB(err, "can't update employees")
+	}
+	return ids, nil
+}
+
+// hasMembers reports whether department has current memberships.
+func hasMembers(ctx context.Context, tx pgx.Tx, departmentID string) (bool, error) {
+	var exists bool
+	sql := "SELECT EXISTS (SELECT 1 FROM employee_department WHERE department_id = $1 AND valid_to IS NULL)"
+	if err := tx.QueryRow(ctx, sql, departmentID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("can't check members: %s", err.Error())
+	}
+	return exists, nil
+}
+
+// closeMemberships ends current memberships of department at path (with its
+// subtree if withSubtree) and returns their amount. Closed memberships stay
+// as history after the department is deleted.
+func closeMemberships(ctx context.Context, tx pgx.Tx, path string, withSubtree bool) (int, error) {
+	sql := `UPDATE employee_department SET valid_to = now()
+		WHERE valid_to IS NULL AND department_id IN
+			(SELECT department_id FROM departments
+				WHERE department_path = $1 OR ($2 AND department_path <@ $1))`
+	tag, err := tx.Exec(ctx, sql, path, withSubtree)
+	if err != nil {
+		return 0, apperror.FromDB(err, "can't close memberships")
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// checkVersion compares department version with expected one, zero expected
+// version means that client didn't send precondition.
+func checkVersion(dp model.Department, expected int) error {
+	if expected != 0 && dp.Version != expected {
+		return apperror.PreconditionFailed("department was modified by someone else")
+	}
+	return nil
+}
+
+// departmentEvents maps audit actions to published event types.
+var departmentEvents = map[string]string{
+	audit.ActionCreate: dto.EventDepartmentCreated,
+	audit.ActionUpdate: dto.EventDepartmentUpdated,
+	audit.ActionMove:   dto.EventDepartmentMoved,
+	audit.ActionDelete: dto.EventDepartmentDeleted,
+}
+
+// recordDepartment writes audit and outbox events of department change, nil
+// state means that department doesn't exist before or after it.
+func recordDepartment(ctx context.Context, tx pgx.Tx, action string, before, after *model.Department) error {
+	e := audit.Event{Action: action, Entity: dto.AuditEntityDepartment}
+	if before != nil {
+		e.EntityID = before.ID
+		e.Before = audit.Department{Name: before.Name, Path: before.Path, HeadID: before.HeadID}
+	}
+	if after != nil {
+		e.EntityID = after.ID
+		e.After = audit.Department{Name: after.Name, Path: after.Path, HeadID: after.HeadID}
+	}
+	if err := audit.Record(ctx, tx, e); err != nil {
+		return err
+	}
+	return outbox.Publish(ctx, tx, departmentEvents[action], e.EntityID,
+		outbox.Change{Before: e.Before, After: e.After})
+}
+
+// pathLabel converts department id to ltree label.
+func pathLabel(departmentID string) string {
+	return strings.ReplaceAll(departmentID, "-", "_")
+}
@@ -0,0 +1,50 @@
+package department
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dimashiro/test_mediasoft/internal/model"
+)
+
+func TestLinkHierarchyLeavesCyclesOut(t *testing.T) {
+	// root <- child, and a <-> b reference each other, c hangs below b
+	parents := map[string]string{"root": "", "child": "root", "a": "b", "b": "a", "c": "b"}
+	paths := map[string]string{"root": "root", "child": "root.child", "a": "b.a", "b": "a.b", "c": "a.b.c"}
+	h := model.Hierarchy{
+		Departments: make(map[string]*model.Department),
+		Roots:       []*model.Department{},
+		Orphans:     []*model.Department{},
+	}
+	dps := []*model.Department{}
+	for _, id := range []string{"a", "b", "c", "child", "root"} {
+		dp := &model.Department{ID: id, Path: paths[id], Children: []*model.Department{}}
+		h.Departments[id] = dp
+		dps = append(dps, dp)
+	}
+
+	linkHierarchy(&h, dps, parents)
+
+	if len(h.Roots) != 1 || h.Roots[0].ID != "root" {
+		t.Fatalf("roots = %v, want only root", ids(h.Roots))
+	}
+	if got := ids(h.Orphans); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("orphans = %v, want [a b c]", got)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if n := len(h.Departments[id].Children); n != 0 {
+			t.Errorf("%s has %d children, departments of cycle must not be linked", id, n)
+		}
+	}
+	if _, err := json.Marshal(h.Roots); err != nil {
+		t.Errorf("can't marshal roots: %v", err)
+	}
+}
+
+func ids(dps []*model.Department) []string {
+	res := make([]string, 0, len(dps))
+	for _, dp := range dps {
+		res = append(res, dp.ID)
+	}
+	return res
+}
@@ -2,11 +2,16 @@ package employee
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
 	"github.com/dimashiro/test_mediasoft/internal/model"
 	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/audit"
+	"github.com/dimashiro/test_mediasoft/internal/repository/outbox"
+	"github.com/dimashiro/test_mediasoft/internal/repository/pgutil"
 	"github.com/google/uuid"
 	pgx "github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -21,12 +26,21 @@ const (
 
 type EmployeeRepo interface {
 	GetByID(ctx context.Context, employeeID string) (model.Employee, error)
+	GetDepartments(ctx context.Context, employeeID string) ([]dto.ViewEmployeeDepartment, error)
 	Create(ctx context.Context, dto *dto.CreateEmployee) (model.Employee, error)
-	GetAll(ctx context.Context) ([]model.Employee, error)
+	GetAll(ctx context.Context, f *dto.ListEmployees, departmentIDs []string) ([]model.Employee, int, error)
 	Delete(ctx context.Context, dto *dto.DeleteEmployee) error
 	Update(ctx context.Context, dto *dto.UpdateEmployee) error
-	GetByDepartment(ctx context.Context, departmentID string) ([]model.Employee, error)
-	GetInDepartmentHierarchy(ctx context.Context, dp model.Department) ([]model.Employee, error)
+	GetByDepartment(ctx context.Context, departmentID string, f *dto.ListEmployees) ([]model.Employee, int, error)
+	GetInDepartmentHierarchy(ctx context.Context, dp model.Department, f *dto.ListEmployees) ([]model.Employee, int, error)
+	Search(ctx context.Context, f *dto.SearchEmployees, subtreePath string, departmentIDs []string) ([]dto.EmployeeSearchResult, error)
+	Timeline(ctx context.Context, employeeID string) ([]dto.MembershipPeriod, error)
+	Import(ctx context.Context, employees []dto.CreateEmployee, dryRun bool) ([]model.Employee, map[int]error, error)
+	Export(ctx context.Context, departmentIDs []string, fn func(dto.EmployeeExportRow) error) error
+	Members(ctx context.Context, subtreePaths []string) (map[string][]model.Employee, error)
+	Managers(ctx context.Context, employeeID string) ([]dto.EmployeeRef, error)
+	Reports(ctx context.Context, employeeID string) ([]dto.EmployeeRef, error)
+	ReportingTree(ctx context.Context, employeeID string, depth int) (*dto.ReportingNode, error)
 }
 
 type Repository struct {
@@ -38,219 +52,737 @@ func New(pool *pgxpool.Pool) *Repository {
 }
 
 func (r *Repository) GetByID(ctx context.Context, employeeID string) (model.Employee, error) {
+	return getEmployee(ctx, r.db, employeeID, "")
+}
+
+// getEmployee reads employee, suffix allows to lock row with FOR UPDATE.
+func getEmployee(ctx context.Context, q pgutil.Querier, employeeID string, suffix string) (model.Employee, error) {
 	employee := model.Employee{}
+	if _, err := uuid.Parse(employeeID); err != nil {
+		return employee, apperror.BadRequest("wrong employee id", err)
+	}
 	query, args, err := sq.
-		Select("*").
+		Select("employee_id", "employee_name", "employee_surname", "employee_birthyear", "manager_id", "version").
 		From(employeeTable).
 		Where(sq.Eq{"employee_id": employeeID}).
+		Suffix(suffix).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
 		return employee, fmt.Errorf("can't build query: %s", err.Error())
 	}
 
-	err = r.db.QueryRow(ctx, query, args...).
-		Scan(&employee.ID, &employee.Name, &employee.Surname, &employee.BirthYear)
+	err = q.QueryRow(ctx, query, args...).
+		Scan(&employee.ID, &employee.Name, &employee.Surname, &employee.BirthYear, &employee.ManagerID, &employee.Version)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return employee, apperror.NotFound("employee not found", err)
+		}
 		return employee, fmt.Errorf("can't scan Employee: %w", err)
 	}
 	return employee, nil
 }
 
 func (r *Repository) Create(ctx context.Context, dto *dto.CreateEmployee) (model.Employee, error) {
-	employee := model.Employee{}
 	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
-		return employee, fmt.Errorf("can't create tx: %s", err.Error())
+		return model.Employee{}, fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	employee, err := insertEmployee(ctx, tx, dto)
+	if err != nil {
+		return employee, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return employee, fmt.Errorf("can't commit tx: %s", err.Error())
+	}
+
+	return employee, nil
+}
+
+// Import creates all employees in one transaction. Every employee is
+// inserted in its own savepoint, so client errors of all of them are
+// returned by index of employee. Nothing is committed if there are such
+// errors or dryRun is set.
+func (r *Repository) Import(ctx context.Context, employees []dto.CreateEmployee, dryRun bool) ([]model.Employee, map[int]error, error) {
+	created := make([]model.Employee, 0, len(employees))
+	rowErrors := make(map[int]error)
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return created, rowErrors, fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	for i := range employees {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return created, rowErrors, fmt.Errorf("can't create savepoint: %s", err.Error())
+		}
+		employee, err := insertEmployee(ctx, sp, &employees[i])
+		if err != nil {
+			// internal errors fail the whole import
+			if apperror.CodeOf(err) == apperror.CodeInternal {
+				return created, rowErrors, err
+			}
+			rowErrors[i] = err
+			if err := sp.Rollback(ctx); err != nil {
+				return created, rowErrors, fmt.Errorf("can't rollback savepoint: %s", err.Error())
+			}
+			continue
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return created, rowErrors, fmt.Errorf("can't release savepoint: %s", err.Error())
+		}
+		created = append(created, employee)
 	}
 
+	if dryRun || len(rowErrors) > 0 {
+		return created, rowErrors, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return created, rowErrors, fmt.Errorf("can't commit tx: %s", err.Error())
+	}
+	return created, rowErrors, nil
+}
+
+// insertEmployee creates employee with departments and records it.
+func insertEmployee(ctx context.Context, tx pgx.Tx, dto *dto.CreateEmployee) (model.Employee, error) {
+	employee := model.Employee{}
 	uuidEmployee := uuid.NewString()
+	// new employee has no reports yet, so its manager can't make a cycle
+	managerID, err := lockManager(ctx, tx, dto.ManagerID)
+	if err != nil {
+		return employee, err
+	}
 	query, args, err := sq.
 		Insert(employeeTable).
-		Columns("employee_id", "employee_name", "employee_surname", "employee_birthyear").
+		Columns("employee_id", "employee_name", "employee_surname", "employee_birthyear", "manager_id").
 		Values(
 			uuidEmployee,
 			dto.Name,
 			dto.Surname,
 			dto.BirthYear,
-		).Suffix("RETURNING *").
+			managerID,
+		).Suffix("RETURNING employee_id, employee_name, employee_surname, employee_birthyear, manager_id, version").
 		PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return employee, fmt.Errorf("can't build sql: %s", err.Error())
 	}
 	// insert into empoyee table.
 	err = tx.QueryRow(ctx, query, args...).
-		Scan(&employee.ID, &employee.Name, &employee.Surname, &employee.BirthYear)
+		Scan(&employee.ID, &employee.Name, &employee.Surname, &employee.BirthYear, &employee.ManagerID, &employee.Version)
 	if err != nil {
-		return model.Employee{}, fmt.Errorf("can't scan Employee: %w", err)
+		return model.Employee{}, apperror.FromDB(err, "can't create employee")
 	}
 
-	//insert into connection table
-	qBuilder := sq.
-		Insert(employeeDepartmentTable).
-		Columns("employee_id", "department_id")
-	for _, dpID := range dto.Departments {
-		if _, err := uuid.Parse(dpID); err != nil {
-			return employee, fmt.Errorf("wrond department id: %s", err.Error())
-		}
-		qBuilder = qBuilder.Values(uuidEmployee, dpID)
+	if err := insertMemberships(ctx, tx, uuidEmployee, membershipsOf(dto.Departments, dto.Memberships)); err != nil {
+		return employee, err
 	}
-	query, args, err = qBuilder.PlaceholderFormat(sq.Dollar).ToSql()
-	if err != nil {
-		return employee, fmt.Errorf("can't build sql: %s", err.Error())
+
+	if err := recordEmployee(ctx, tx, audit.ActionCreate, employee.ID, nil); err != nil {
+		return employee, err
 	}
 
-	_, err = tx.Exec(ctx, query, args...)
+	return employee, nil
+}
+
+var employeeSortColumns = map[string]string{
+	"name":      "e.employee_name",
+	"surname":   "e.employee_surname",
+	"birthyear": "e.employee_birthyear",
+}
+
+// employeeFilters converts list request to conditions on employees aliased as e.
+func employeeFilters(f *dto.ListEmployees) sq.And {
+	filters := sq.And{}
+	if f.SurnamePrefix != "" {
+		filters = append(filters, sq.ILike{"e.employee_surname": pgutil.LikePrefix(f.SurnamePrefix)})
+	}
+	if f.BirthYearFrom > 0 {
+		filters = append(filters, sq.GtOrEq{"e.employee_birthyear": f.BirthYearFrom})
+	}
+	if f.BirthYearTo > 0 {
+		filters = append(filters, sq.LtOrEq{"e.employee_birthyear": f.BirthYearTo})
+	}
+	if f.DepartmentID != "" {
+		filters = append(filters, sq.Expr(`EXISTS (SELECT 1 FROM employee_department f_ed
+			WHERE f_ed.employee_id = e.employee_id AND f_ed.department_id = ? AND ?)`,
+			f.DepartmentID, pgutil.MembershipAt("f_ed", f.AsOf)))
+	}
+	return filters
+}
+
+// inSubtrees limits employees aliased as e to current members of subtrees
+// of departmentIDs.
+func inSubtrees(departmentIDs []string) sq.Sqlizer {
+	return sq.Expr(`EXISTS (SELECT 1 FROM employee_department s_ed
+		JOIN departments s_d ON s_d.department_id = s_ed.department_id
+		JOIN departments s_root ON s_d.department_path <@ s_root.department_path
+		WHERE s_ed.employee_id = e.employee_id AND s_ed.valid_to IS NULL
+			AND s_root.department_id = ANY(?::uuid[]))`, departmentIDs)
+}
+
+func employeeOrder(f *dto.ListEmployees) string {
+	return pgutil.OrderBy(f.Sort, employeeSortColumns, "e.employee_surname ASC") +
+		", e.employee_name ASC, e.employee_id ASC"
+}
+
+// count returns amount of rows matched by select builder.
+func (r *Repository) count(ctx context.Context, b sq.SelectBuilder) (int, error) {
+	query, args, err := sq.Select("count(*)").
+		FromSelect(b, "c").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
 	if err != nil {
-		rollbackErr := tx.Rollback(ctx)
-		if rollbackErr != nil {
-			return employee, fmt.Errorf("rollback err: %s, err: %s", rollbackErr.Error(), err.Error())
-		}
+		return 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	var total int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("can't count employees: %s", err.Error())
+	}
+	return total, nil
+}
 
-		return employee, err
+// GetAll returns page of employees matching f, non-nil departmentIDs limit
+// them to current members of their subtrees.
+func (r *Repository) GetAll(ctx context.Context, f *dto.ListEmployees, departmentIDs []string) ([]model.Employee, int, error) {
+	empls := []model.Employee{}
+	base := sq.
+		Select("e.employee_id", "e.employee_name", "e.employee_surname", "e.employee_birthyear",
+			"e.manager_id", "e.version").
+		From(employeeTable + " AS e").
+		Where(employeeFilters(f))
+	if departmentIDs != nil {
+		base = base.Where(inSubtrees(departmentIDs))
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return employee, fmt.Errorf("can't commit tx: %s", err.Error())
+	total, err := r.count(ctx, base)
+	if err != nil {
+		return empls, 0, err
 	}
 
-	return employee, nil
-}
+	query, args, err := pgutil.Paginate(base.OrderBy(employeeOrder(f)), f.Limit, f.Offset).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return empls, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return empls, 0, fmt.Errorf("can't select employees: %s", err.Error())
+	}
+	defer rows.Close()
 
-func (r *Repository) GetAll(ctx context.Context) ([]model.Employee, error) {
-	var empls []model.Employee
-	emplMap := make(map[string]model.Employee)
-	query, args, err := sq.
-		Select("employee_id", "employee_name", "employee_surname",
-			"employee_birthyear", "d.department_id", "d.department_name",
-			"d.department_path").
-		From(employeeTable).
-		Join(employeeDepartmentTable + " USING (employee_id)").
+	emplIdx := make(map[string]int)
+	var ids []string
+	for rows.Next() {
+		empl := model.Employee{Departments: []model.Department{}, Memberships: []model.Membership{}}
+		err := rows.Scan(&empl.ID, &empl.Name, &empl.Surname, &empl.BirthYear, &empl.ManagerID, &empl.Version)
+		if err != nil {
+			return empls, 0, fmt.Errorf("can't scan employee: %s", err.Error())
+		}
+		emplIdx[empl.ID] = len(empls)
+		ids = append(ids, empl.ID)
+		empls = append(empls, empl)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return empls, total, nil
+	}
+
+	// departments of selected page
+	query, args, err = sq.
+		Select("ed.employee_id", "d.department_id", "d.department_name", "d.department_path", "d.version",
+			"ed.position", "ed.fte", "ed.is_primary").
+		From(employeeDepartmentTable + " AS ed").
 		Join(departmentTable + " AS d USING (department_id)").
+		Where(sq.Eq{"ed.employee_id": ids}).
+		Where(pgutil.MembershipAt("ed", f.AsOf)).
+		OrderBy("d.department_path").
+		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return empls, fmt.Errorf("can't build query: %s", err.Error())
+		return empls, 0, fmt.Errorf("can't build query: %s", err.Error())
 	}
-	rows, err := r.db.Query(ctx, query, args...)
+	rows, err = r.db.Query(ctx, query, args...)
 	if err != nil {
-		return empls, fmt.Errorf("can't select employees: %s", err.Error())
+		return empls, 0, fmt.Errorf("can't select departments: %s", err.Error())
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		empl := model.Employee{}
+		var emplID string
 		dptm := model.Department{}
-		err := rows.Scan(&empl.ID, &empl.Name, &empl.Surname,
-			&empl.BirthYear, &dptm.ID, &dptm.Name, &dptm.Path)
+		m := model.Membership{}
+		err := rows.Scan(&emplID, &dptm.ID, &dptm.Name, &dptm.Path, &dptm.Version, &m.Position, &m.FTE, &m.Primary)
 		if err != nil {
-			return empls, fmt.Errorf("can't scan employee: %s", err.Error())
-		}
-		if e, ok := emplMap[empl.ID]; ok {
-			e.Departments = append(e.Departments, dptm)
-			emplMap[empl.ID] = e
-		} else {
-			empl.Departments = append(empl.Departments, dptm)
-			emplMap[empl.ID] = empl
+			return empls, 0, fmt.Errorf("can't scan department: %s", err.Error())
 		}
+		m.DepartmentID = dptm.ID
+		i := emplIdx[emplID]
+		empls[i].Departments = append(empls[i].Departments, dptm)
+		empls[i].Memberships = append(empls[i].Memberships, m)
 	}
+	return empls, total, nil
+}
 
-	for _, e := range emplMap {
-		empls = append(empls, e)
+func (r *Repository) GetByDepartment(ctx context.Context, departmentID string, f *dto.ListEmployees) ([]model.Employee, int, error) {
+	empls := []model.Employee{}
+	if _, err := uuid.Parse(departmentID); err != nil {
+		return empls, 0, apperror.BadRequest("wrong department id", err)
 	}
-	return empls, nil
+
+	base := sq.
+		Select("e.employee_id", "e.employee_name", "e.employee_surname",
+			"e.employee_birthyear", "e.manager_id", "e.version",
+			"ed.department_id", "ed.position", "ed.fte", "ed.is_primary").
+		From(employeeDepartmentTable + " AS ed").
+		Join(employeeTable + " AS e USING (employee_id)").
+		Where(sq.Eq{"ed.department_id": departmentID}).
+		Where(pgutil.MembershipAt("ed", f.AsOf)).
+		Where(employeeFilters(f))
+
+	return r.selectEmployees(ctx, base, f)
 }
 
-func (r *Repository) GetByDepartment(ctx context.Context, departmentID string) ([]model.Employee, error) {
-	empls := []model.Employee{}
+// GetInDepartmentHierarchy returns employees of department and its descendants,
+// employee is returned once per matched membership. Distinct list returns
+// employee once with all matched departments and memberships.
+func (r *Repository) GetInDepartmentHierarchy(ctx context.Context, dp model.Department, f *dto.ListEmployees) ([]model.Employee, int, error) {
+	if f.Distinct {
+		return r.getDistinctInDepartmentHierarchy(ctx, dp, f)
+	}
+	base := sq.
+		Select("e.employee_id", "e.employee_name", "e.employee_surname",
+			"e.employee_birthyear", "e.manager_id", "e.version",
+			"ed.department_id", "ed.position", "ed.fte", "ed.is_primary").
+		From(employeeDepartmentTable + " AS ed").
+		Join(employeeTable + " AS e USING (employee_id)").
+		Where(sq.Expr("ed.department_id IN (SELECT department_id FROM departments WHERE department_path <@ ?)", dp.Path)).
+		Where(pgutil.MembershipAt("ed", f.AsOf)).
+		Where(employeeFilters(f))
 
-	query, args, err := sq.
+	return r.selectEmployees(ctx, base, f)
+}
+
+func (r *Repository) getDistinctInDepartmentHierarchy(ctx context.Context, dp model.Department, f *dto.ListEmployees) ([]model.Employee, int, error) {
+	empls := []model.Employee{}
+	base := sq.
 		Select("e.employee_id", "e.employee_name", "e.employee_surname",
-			"e.employee_birthyear").
-		From(departmentTable).
-		Join(employeeDepartmentTable + " USING (department_id)").
+			"e.employee_birthyear", "e.manager_id", "e.version",
+			`jsonb_agg(jsonb_build_object('ID', d.department_id, 'Name', d.department_name,
+				'Path', d.department_path::text, 'HeadID', d.head_id, 'Version', d.version) ORDER BY d.department_path)`,
+			`jsonb_agg(jsonb_build_object('DepartmentID', d.department_id, 'Position', ed.position,
+				'FTE', ed.fte, 'Primary', ed.is_primary) ORDER BY d.department_path)`).
+		From(employeeDepartmentTable + " AS ed").
 		Join(employeeTable + " AS e USING (employee_id)").
-		Where(sq.Eq{"department_id": departmentID}).
+		Join(departmentTable + " AS d ON d.department_id = ed.department_id").
+		Where(sq.Expr("d.department_path <@ ?", dp.Path)).
+		Where(pgutil.MembershipAt("ed", f.AsOf)).
+		Where(employeeFilters(f)).
+		GroupBy("e.employee_id")
+
+	total, err := r.count(ctx, base)
+	if err != nil {
+		return empls, 0, err
+	}
+
+	query, args, err := pgutil.Paginate(base.OrderBy(employeeOrder(f)), f.Limit, f.Offset).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return empls, fmt.Errorf("can't build query: %s", err.Error())
+		return empls, 0, fmt.Errorf("can't build query: %s", err.Error())
 	}
 	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return empls, fmt.Errorf("can't select employees: %s", err.Error())
+		return empls, 0, fmt.Errorf("can't select employees: %s", err.Error())
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		empl := model.Employee{}
 		err := rows.Scan(&empl.ID, &empl.Name, &empl.Surname,
-			&empl.BirthYear)
+			&empl.BirthYear, &empl.ManagerID, &empl.Version,
+			&empl.Departments, &empl.Memberships)
 		if err != nil {
-			return empls, fmt.Errorf("can't scan employee: %s", err.Error())
+			return empls, 0, fmt.Errorf("can't scan employee: %s", err.Error())
 		}
 		empls = append(empls, empl)
 	}
-	return empls, nil
+	return empls, total, nil
 }
 
-func (r *Repository) GetInDepartmentHierarchy(ctx context.Context, dp model.Department) ([]model.Employee, error) {
+// selectEmployees counts and reads requested page of employees selected by
+// base, each row is employee with one of its memberships.
+func (r *Repository) selectEmployees(ctx context.Context, base sq.SelectBuilder, f *dto.ListEmployees) ([]model.Employee, int, error) {
 	empls := []model.Employee{}
+	total, err := r.count(ctx, base)
+	if err != nil {
+		return empls, 0, err
+	}
 
-	//get hierarchy ids
-	sql := "SELECT department_id FROM departments WHERE department_path <@ $1"
-	rows, err := r.db.Query(ctx, sql, dp.Path)
+	query, args, err := pgutil.Paginate(base.OrderBy(employeeOrder(f)), f.Limit, f.Offset).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return empls, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return empls, fmt.Errorf("can't get department hierarchy: %s", err.Error())
+		return empls, 0, fmt.Errorf("can't select employees: %s", err.Error())
 	}
-	var dpIDs []string
+	defer rows.Close()
+
 	for rows.Next() {
-		var dpID string
-		err := rows.Scan(&dpID)
+		empl := model.Employee{}
+		m := model.Membership{}
+		err := rows.Scan(&empl.ID, &empl.Name, &empl.Surname,
+			&empl.BirthYear, &empl.ManagerID, &empl.Version,
+			&m.DepartmentID, &m.Position, &m.FTE, &m.Primary)
 		if err != nil {
-			return empls, fmt.Errorf("can't scan department id: %s", err.Error())
+			return empls, 0, fmt.Errorf("can't scan employee: %s", err.Error())
 		}
-		dpIDs = append(dpIDs, dpID)
+		empl.Memberships = []model.Membership{m}
+		empls = append(empls, empl)
 	}
-	rows.Close()
+	return empls, total, nil
+}
 
+// GetDepartments returns departments of employee with their full path names.
+func (r *Repository) GetDepartments(ctx context.Context, employeeID string) ([]dto.ViewEmployeeDepartment, error) {
+	dps := []dto.ViewEmployeeDepartment{}
 	query, args, err := sq.
-		Select("e.employee_id", "e.employee_name", "e.employee_surname",
-			"e.employee_birthyear").
-		From(departmentTable).
-		Join(employeeDepartmentTable + " USING (department_id)").
-		Join(employeeTable + " AS e USING (employee_id)").
-		Where(sq.Eq{"department_id": dpIDs}).
+		Select("d.department_id", "d.department_name", "d.department_path", pgutil.DepartmentFullPath,
+			"ed.position", "ed.fte", "ed.is_primary").
+		From(employeeDepartmentTable + " AS ed").
+		Join(departmentTable + " AS d USING (department_id)").
+		Where(sq.Eq{"ed.employee_id": employeeID}).
+		Where("ed.valid_to IS NULL").
+		OrderBy("d.department_path").
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return empls, fmt.Errorf("can't build query: %s", err.Error())
+		return dps, fmt.Errorf("can't build query: %s", err.Error())
 	}
-	rows, err = r.db.Query(ctx, query, args...)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return empls, fmt.Errorf("can't select employees: %s", err.Error())
+		return dps, fmt.Errorf("can't select departments: %s", err.Error())
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		empl := model.Employee{}
-		err := rows.Scan(&empl.ID, &empl.Name, &empl.Surname,
-			&empl.BirthYear)
+		dp := dto.ViewEmployeeDepartment{}
+		if err := rows.Scan(&dp.ID, &dp.Name, &dp.Path, &dp.FullPath, &dp.Position, &dp.FTE, &dp.Primary); err != nil {
+			return dps, fmt.Errorf("can't scan department: %s", err.Error())
+		}
+		dps = append(dps, dp)
+	}
+	return dps, nil
+}
+
+// Members returns current members of departments in subtrees by department
+// id ordered by surname and name, nil subtreePaths means all departments.
+func (r *Repository) Members(ctx context.Context, subtreePaths []string) (map[string][]model.Employee, error) {
+	members := make(map[string][]model.Employee)
+	b := sq.
+		Select("ed.department_id", "e.employee_id", "e.employee_name", "e.employee_surname").
+		From(employeeDepartmentTable+" AS ed").
+		Join(employeeTable+" AS e USING (employee_id)").
+		Where("ed.valid_to IS NULL").
+		OrderBy("e.employee_surname", "e.employee_name", "e.employee_id")
+	if subtreePaths != nil {
+		b = b.Join(departmentTable + " AS d ON d.department_id = ed.department_id").
+			Where(sq.Expr("d.department_path <@ ?::text[]::ltree[]", subtreePaths))
+	}
+	query, args, err := b.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return members, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return members, fmt.Errorf("can't select members: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var departmentID string
+		e := model.Employee{}
+		if err := rows.Scan(&departmentID, &e.ID, &e.Name, &e.Surname); err != nil {
+			return members, fmt.Errorf("can't scan member: %s", err.Error())
+		}
+		members[departmentID] = append(members[departmentID], e)
+	}
+	return members, nil
+}
+
+// Export calls fn for every employee ordered by surname and name, non-nil
+// departmentIDs limit employees to current members of their subtrees. Rows
+// are read from the cursor one by one, so result is never loaded as a whole.
+func (r *Repository) Export(ctx context.Context, departmentIDs []string, fn func(dto.EmployeeExportRow) error) error {
+	b := sq.
+		Select("e.employee_id", "e.employee_name", "e.employee_surname", "coalesce(e.employee_birthyear, 0)",
+			`coalesce((SELECT array_agg(`+pgutil.DepartmentFullPath+` ORDER BY d.department_path)
+				FROM employee_department ed JOIN departments d USING (department_id)
+				WHERE ed.employee_id = e.employee_id AND ed.valid_to IS NULL), '{}')`).
+		From(employeeTable + " AS e")
+	if departmentIDs != nil {
+		b = b.Where(inSubtrees(departmentIDs))
+	}
+	query, args, err := b.
+		OrderBy("e.employee_surname", "e.employee_name", "e.employee_id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't select employees: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := dto.EmployeeExportRow{}
+		if err := rows.Scan(&e.ID, &e.Name, &e.Surname, &e.BirthYear, &e.Departments); err != nil {
+			return fmt.Errorf("can't scan employee: %s", err.Error())
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("can't read employees: %s", err.Error())
+	}
+	return nil
+}
+
+// Timeline returns all memberships of employee including closed ones,
+// oldest first. Departments deleted since then have empty name and path.
+func (r *Repository) Timeline(ctx context.Context, employeeID string) ([]dto.MembershipPeriod, error) {
+	periods := []dto.MembershipPeriod{}
+	query, args, err := sq.
+		Select("ed.department_id", "coalesce(d.department_name, '')",
+			"coalesce("+pgutil.DepartmentFullPath+", '')", "ed.valid_from", "ed.valid_to").
+		From(employeeDepartmentTable+" AS ed").
+		LeftJoin(departmentTable+" AS d USING (department_id)").
+		Where(sq.Eq{"ed.employee_id": employeeID}).
+		OrderBy("ed.valid_from", "d.department_path").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return periods, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return periods, fmt.Errorf("can't select memberships: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := dto.MembershipPeriod{}
+		if err := rows.Scan(&p.DepartmentID, &p.DepartmentName, &p.FullPath, &p.ValidFrom, &p.ValidTo); err != nil {
+			return periods, fmt.Errorf("can't scan membership: %s", err.Error())
+		}
+		periods = append(periods, p)
+	}
+	return periods, nil
+}
+
+// Managers returns chain of managers of employee from the direct one up.
+func (r *Repository) Managers(ctx context.Context, employeeID string) ([]dto.EmployeeRef, error) {
+	refs := []dto.EmployeeRef{}
+	// seen guards against cycles, which writes don't let in
+	sql := `WITH RECURSIVE chain AS (
+			SELECT m.employee_id, m.employee_name, m.employee_surname, m.manager_id,
+				1 AS level, ARRAY[e.employee_id, m.employee_id] AS seen
+			FROM employees e JOIN employees m ON m.employee_id = e.manager_id
+			WHERE e.employee_id = $1
+			UNION ALL
+			SELECT m.employee_id, m.employee_name, m.employee_surname, m.manager_id,
+				c.level + 1, c.seen || m.employee_id
+			FROM chain c JOIN employees m ON m.employee_id = c.manager_id
+			WHERE m.employee_id <> ALL(c.seen)
+		)
+		SELECT employee_id, employee_name, employee_surname FROM chain ORDER BY level`
+	rows, err := r.db.Query(ctx, sql, employeeID)
+	if err != nil {
+		return refs, apperror.FromDB(err, "can't select managers")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ref := dto.EmployeeRef{}
+		if err := rows.Scan(&ref.ID, &ref.Name, &ref.Surname); err != nil {
+			return refs, fmt.Errorf("can't scan manager: %s", err.Error())
+		}
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return refs, apperror.FromDB(err, "can't select managers")
+	}
+	return refs, nil
+}
+
+// Reports returns employees reporting directly to employee.
+func (r *Repository) Reports(ctx context.Context, employeeID string) ([]dto.EmployeeRef, error) {
+	refs := []dto.EmployeeRef{}
+	query, args, err := sq.
+		Select("employee_id", "employee_name", "employee_surname").
+		From(employeeTable).
+		Where(sq.Eq{"manager_id": employeeID}).
+		OrderBy("employee_surname", "employee_name", "employee_id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return refs, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return refs, fmt.Errorf("can't select reports: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ref := dto.EmployeeRef{}
+		if err := rows.Scan(&ref.ID, &ref.Name, &ref.Surname); err != nil {
+			return refs, fmt.Errorf("can't scan report: %s", err.Error())
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// ReportingTree returns employee with everyone reporting to it at most
+// depth levels below, zero depth means all of them.
+func (r *Repository) ReportingTree(ctx context.Context, employeeID string, depth int) (*dto.ReportingNode, error) {
+	sql := `WITH RECURSIVE tree AS (
+			SELECT employee_id, employee_name, employee_surname, manager_id,
+				0 AS level, ARRAY[employee_id] AS seen
+			FROM employees WHERE employee_id = $1
+			UNION ALL
+			SELECT e.employee_id, e.employee_name, e.employee_surname, e.manager_id,
+				t.level + 1, t.seen || e.employee_id
+			FROM tree t JOIN employees e ON e.manager_id = t.employee_id
+			WHERE e.employee_id <> ALL(t.seen) AND ($2::int = 0 OR t.level < $2::int)
+		)
+		SELECT employee_id, employee_name, employee_surname, coalesce(manager_id::text, ''), level
+		FROM tree ORDER BY level, employee_surname, employee_name, employee_id`
+	rows, err := r.db.Query(ctx, sql, employeeID, depth)
+	if err != nil {
+		return nil, apperror.FromDB(err, "can't select reports")
+	}
+	defer rows.Close()
+
+	// managers go before their reports in order of levels
+	nodes := make(map[string]*dto.ReportingNode)
+	var root *dto.ReportingNode
+	for rows.Next() {
+		n := &dto.ReportingNode{Reports: []*dto.ReportingNode{}}
+		var managerID string
+		var level int
+		if err := rows.Scan(&n.ID, &n.Name, &n.Surname, &managerID, &level); err != nil {
+			return nil, fmt.Errorf("can't scan report: %s", err.Error())
+		}
+		nodes[n.ID] = n
+		if level == 0 {
+			root = n
+			continue
+		}
+		if manager, ok := nodes[managerID]; ok {
+			manager.Reports = append(manager.Reports, n)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.FromDB(err, "can't select reports")
+	}
+	if root == nil {
+		return nil, apperror.NotFound("employee not found", nil)
+	}
+	return root, nil
+}
+
+// fullNameExpr matches expression of trigram and full-text indexes.
+const fullNameExpr = "(e.employee_name || ' ' || e.employee_surname)"
+
+// Search finds employees by name and surname using full-text match and
+// trigram word similarity, so typos like "stantn" still find "Stanton".
+// Non-empty subtreePath restricts result to members of that department subtree,
+// non-nil departmentIDs to members of their subtrees.
+func (r *Repository) Search(ctx context.Context, f *dto.SearchEmployees, subtreePath string, departmentIDs []string) ([]dto.EmployeeSearchResult, error) {
+	res := []dto.EmployeeSearchResult{}
+	tsQuery := "to_tsvector('simple', " + fullNameExpr + ") @@ plainto_tsquery('simple', ?)"
+	builder := sq.
+		Select("e.employee_id", "e.employee_name", "e.employee_surname", "e.employee_birthyear").
+		Column(sq.Expr("ts_rank(to_tsvector('simple', "+fullNameExpr+"), plainto_tsquery('simple', ?)) + word_similarity(?, "+fullNameExpr+") AS rank",
+			f.Query, f.Query)).
+		From(employeeTable + " AS e").
+		Where(sq.Or{
+			sq.Expr(tsQuery, f.Query),
+			sq.Expr("? <% "+fullNameExpr, f.Query),
+		})
+	if subtreePath != "" {
+		builder = builder.Where(sq.Expr(`EXISTS (SELECT 1 FROM employee_department s_ed
+			JOIN departments s_d USING (department_id)
+			WHERE s_ed.employee_id = e.employee_id AND s_ed.valid_to IS NULL AND s_d.department_path <@ ?)`, subtreePath))
+	}
+	if departmentIDs != nil {
+		builder = builder.Where(inSubtrees(departmentIDs))
+	}
+	query, args, err := builder.
+		OrderBy("rank DESC", "e.employee_surname", "e.employee_id").
+		Limit(uint64(f.Limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return res, fmt.Errorf("can't build query: %s", err.Error())
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return res, fmt.Errorf("can't search employees: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		empl := dto.EmployeeSearchResult{}
+		err := rows.Scan(&empl.ID, &empl.Name, &empl.Surname, &empl.BirthYear, &empl.Rank)
 		if err != nil {
-			return empls, fmt.Errorf("can't scan employee: %s", err.Error())
+			return res, fmt.Errorf("can't scan employee: %s", err.Error())
 		}
-		empls = append(empls, empl)
+		res = append(res, empl)
 	}
-	return empls, nil
+	return res, nil
 }
 
 func (r *Repository) Update(ctx context.Context, dto *dto.UpdateEmployee) error {
-	employee := model.Employee{}
-	if _, err := uuid.Parse(dto.ID); err == nil {
-		employee, err = r.GetByID(ctx, dto.ID)
-		if err != nil {
-			return fmt.Errorf("employee not found: %s", err.Error())
+	if _, err := uuid.Parse(dto.ID); err != nil {
+		return apperror.BadRequest("wrong id", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	if dto.ManagerID != nil && *dto.ManagerID != "" {
+		if err := lockManagers(ctx, tx); err != nil {
+			return err
 		}
 	}
+	employee, err := getEmployee(ctx, tx, dto.ID, "FOR UPDATE")
+	if err != nil {
+		return apperror.Wrap(err, "employee not found")
+	}
+	if err := checkVersion(employee, dto.Version); err != nil {
+		return err
+	}
+	before, err := loadState(ctx, tx, employee.ID)
+	if err != nil {
+		return err
+	}
 	if dto.Name != nil {
 		employee.Name = *dto.Name
 	}
@@ -261,36 +793,313 @@ func (r *Repository) Update(ctx context.Context, dto *dto.UpdateEmployee) error
 		employee.BirthYear = *dto.BirthYear
 	}
 
-	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return fmt.Errorf("can't create tx: %s", err.Error())
-	}
-
 	//update employee
-	query, args, err := sq.
+	b := sq.
 		Update(employeeTable).
 		Set("employee_name", employee.Name).
 		Set("employee_surname", employee.Surname).
 		Set("employee_birthyear", employee.BirthYear).
-		Where(sq.Eq{"employee_id": employee.ID}).
-		PlaceholderFormat(sq.Dollar).ToSql()
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{"employee_id": employee.ID})
+	if dto.ManagerID != nil {
+		managerID, err := changeManager(ctx, tx, employee.ID, *dto.ManagerID)
+		if err != nil {
+			return err
+		}
+		b = b.Set("manager_id", managerID)
+	}
+	query, args, err := b.PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return fmt.Errorf("can't build sql: %s", err.Error())
 	}
 
 	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
-		rollbackErr := tx.Rollback(ctx)
-		if rollbackErr != nil {
-			return fmt.Errorf("rollback err: %s, err: %s", rollbackErr.Error(), err.Error())
+		return apperror.FromDB(err, "can't update employee")
+	}
+
+	// nil departments keep current memberships
+	if dto.Departments != nil {
+		if err := replaceDepartments(ctx, tx, employee.ID, dto.Departments, dto.Memberships); err != nil {
+			return err
+		}
+	}
+
+	if err := recordEmployee(ctx, tx, audit.ActionUpdate, employee.ID, before); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can't commit tx: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, dto *dto.DeleteEmployee) error {
+	if _, err := uuid.Parse(dto.ID); err != nil {
+		return apperror.BadRequest("wrong id", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("can't create tx: %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockManagers(ctx, tx); err != nil {
+		return err
+	}
+	employee, err := getEmployee(ctx, tx, dto.ID, "FOR UPDATE")
+	if err != nil {
+		return apperror.Wrap(err, "employee not found")
+	}
+	if err := checkVersion(employee, dto.Version); err != nil {
+		return err
+	}
+	before, err := loadState(ctx, tx, employee.ID)
+	if err != nil {
+		return err
+	}
+	if err := reassignReports(ctx, tx, employee); err != nil {
+		return err
+	}
+
+	query, args, err := sq.
+		Delete(employeeTable).
+		Where(sq.Eq{"employee_id": dto.ID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build query: %s", err.Error())
+	}
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		return apperror.FromDB(err, "can't delete employee")
+	}
+
+	if err := recordEmployee(ctx, tx, audit.ActionDelete, employee.ID, before); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can't commit tx: %s", err.Error())
+	}
+	return nil
+}
+
+// checkVersion compares employee version with expected one from If-Match,
+// zero means that client didn't send precondition.
+func checkVersion(employee model.Employee, expected int) error {
+	if expected != 0 && employee.Version != expected {
+		return apperror.PreconditionFailed("employee was modified by someone else")
+	}
+	return nil
+}
+
+// lockManager checks that manager exists and keeps it from being deleted
+// till the end of tx. Empty managerID means no manager and returns nil to
+// store NULL.
+func lockManager(ctx context.Context, tx pgx.Tx, managerID string) (interface{}, error) {
+	if managerID == "" {
+		return nil, nil
+	}
+	if _, err := uuid.Parse(managerID); err != nil {
+		return nil, apperror.BadRequest("wrong manager id", err)
+	}
+	manager, err := getEmployee(ctx, tx, managerID, "FOR SHARE")
+	if err != nil {
+		return nil, apperror.Wrap(err, "manager not found")
+	}
+	return manager.ID, nil
+}
+
+// lockManagers serializes changes of managers till the end of tx,
+// otherwise concurrent changes of different employees could close a cycle
+// that neither of them sees. It must be taken before any row locks.
+func lockManagers(ctx context.Context, tx pgx.Tx) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('employees.manager_id'))"); err != nil {
+		return fmt.Errorf("can't lock managers: %s", err.Error())
+	}
+	return nil
+}
+
+// changeManager checks that new manager of employee doesn't report to it
+// directly or through other managers, tx must hold lockManagers.
+func changeManager(ctx context.Context, tx pgx.Tx, employeeID, managerID string) (interface{}, error) {
+	if managerID == "" {
+		return nil, nil
+	}
+	if managerID == employeeID {
+		return nil, apperror.Conflict("employee can't be its own manager", nil)
+	}
+	id, err := lockManager(ctx, tx, managerID)
+	if err != nil {
+		return nil, err
+	}
+	sql := `WITH RECURSIVE chain AS (
+			SELECT employee_id, manager_id FROM employees WHERE employee_id = $1
+			UNION
+			SELECT e.employee_id, e.manager_id FROM employees e JOIN chain c ON e.employee_id = c.manager_id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE employee_id = $2)`
+	var cycle bool
+	if err := tx.QueryRow(ctx, sql, managerID, employeeID).Scan(&cycle); err != nil {
+		return nil, fmt.Errorf("can't check managers: %s", err.Error())
+	}
+	if cycle {
+		return nil, apperror.Conflict("manager reports to the employee, it would make a cycle", nil)
+	}
+	return id, nil
+}
+
+// reassignReports moves direct reports of employee that is being deleted
+// to its manager, so their reporting lines are kept. It can't make a cycle
+// as chains only get shorter, tx must hold lockManagers.
+func reassignReports(ctx context.Context, tx pgx.Tx, employee model.Employee) error {
+	sql := "SELECT employee_id FROM employees WHERE manager_id = $1 ORDER BY employee_id FOR UPDATE"
+	rows, err := tx.Query(ctx, sql, employee.ID)
+	if err != nil {
+		return fmt.Errorf("can't select reports: %s", err.Error())
+	}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("can't scan report: %s", err.Error())
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("can't select reports: %s", err.Error())
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	before, err := audit.LoadEmployees(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+	sql = "UPDATE employees SET manager_id = $2, version = version + 1 WHERE employee_id = ANY($1::uuid[])"
+	if _, err := tx.Exec(ctx, sql, ids, employee.ManagerID); err != nil {
+		return apperror.FromDB(err, "can't reassign reports")
+	}
+	for _, id := range ids {
+		state := before[id]
+		if err := recordEmployee(ctx, tx, audit.ActionUpdate, id, &state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadState reads audited state of employee inside tx.
+func loadState(ctx context.Context, tx pgx.Tx, employeeID string) (*audit.Employee, error) {
+	states, err := audit.LoadEmployees(ctx, tx, []string{employeeID})
+	if err != nil {
+		return nil, err
+	}
+	state, ok := states[employeeID]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// employeeEvents maps audit actions to published event types.
+var employeeEvents = map[string]string{
+	audit.ActionCreate: dto.EventEmployeeCreated,
+	audit.ActionUpdate: dto.EventEmployeeUpdated,
+	audit.ActionDelete: dto.EventEmployeeDeleted,
+}
+
+// recordEmployee writes audit and outbox events comparing given state before
+// the change with the current one, nil state means that employee doesn't exist.
+func recordEmployee(ctx context.Context, tx pgx.Tx, action, employeeID string, before *audit.Employee) error {
+	after, err := loadState(ctx, tx, employeeID)
+	if err != nil {
+		return err
+	}
+	e := audit.Event{Action: action, Entity: dto.AuditEntityEmployee, EntityID: employeeID}
+	var dpsBefore, dpsAfter []string
+	if before != nil {
+		e.Before = before
+		dpsBefore = before.Departments
+	}
+	if after != nil {
+		e.After = after
+		dpsAfter = after.Departments
+	}
+	if err := audit.Record(ctx, tx, e); err != nil {
+		return err
+	}
+	err = outbox.Publish(ctx, tx, employeeEvents[action], employeeID, outbox.Change{Before: e.Before, After: e.After})
+	if err != nil {
+		return err
+	}
+	return outbox.MembershipChanged(ctx, tx, employeeID, dpsBefore, dpsAfter)
+}
+
+// membershipsOf returns given memberships or full time memberships without
+// position in departments if there are none.
+func membershipsOf(departmentIDs []string, memberships []dto.Membership) []dto.Membership {
+	if memberships != nil {
+		return memberships
+	}
+	ms := make([]dto.Membership, 0, len(departmentIDs))
+	for _, id := range departmentIDs {
+		ms = append(ms, dto.Membership{DepartmentID: id})
+	}
+	return ms
+}
+
+// fteOf returns share of full time of membership, nil means full time.
+func fteOf(m dto.Membership) float64 {
+	if m.FTE == nil {
+		return 1
+	}
+	return *m.FTE
+}
+
+// insertMemberships adds employee to departments of memberships.
+func insertMemberships(ctx context.Context, tx pgx.Tx, employeeID string, memberships []dto.Membership) error {
+	if len(memberships) == 0 {
+		return nil
+	}
+	qBuilder := sq.
+		Insert(employeeDepartmentTable).
+		Columns("employee_id", "department_id", "position", "fte", "is_primary")
+	for _, m := range memberships {
+		if _, err := uuid.Parse(m.DepartmentID); err != nil {
+			return apperror.BadRequest("wrong department id", err)
 		}
-		return fmt.Errorf("can't update employee: %w", err)
+		qBuilder = qBuilder.Values(employeeID, m.DepartmentID, m.Position, fteOf(m), m.Primary)
+	}
+	query, args, err := qBuilder.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
 	}
 
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		return apperror.FromDB(err, "can't add employee to departments")
+	}
+	return nil
+}
+
+// replaceDepartments syncs employee memberships with departmentIDs. Non-nil
+// memberships rewrite positions of remaining memberships too, otherwise they
+// are kept and new memberships are full time without position.
+func replaceDepartments(ctx context.Context, tx pgx.Tx, employeeID string, departmentIDs []string,
+	memberships []dto.Membership) error {
 	//get old departments
-	query, args, err = sq.Select("department_id").
+	query, args, err := sq.Select("department_id").
 		From(employeeDepartmentTable).
-		Where(sq.Eq{"employee_id": dto.ID}).
+		Where(sq.Eq{"employee_id": employeeID}).
+		Where("valid_to IS NULL").
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
@@ -310,44 +1119,24 @@ func (r *Repository) Update(ctx context.Context, dto *dto.UpdateEmployee) error
 		}
 		oldDepartments[dpID] = false
 	}
+	rows.Close()
 
-	//insert into connection table
 	//TODO check for not existing departments in dto
-	qBuilder := sq.
-		Insert(employeeDepartmentTable).
-		Columns("employee_id", "department_id")
-	needInsert := false
-	for _, dpID := range dto.Departments {
-		if _, err := uuid.Parse(dpID); err != nil {
-			return fmt.Errorf("wrond department id: %s", err.Error())
-		}
-		_, ok := oldDepartments[dpID]
-		if !ok {
-			qBuilder = qBuilder.Values(dto.ID, dpID)
-			needInsert = true
-		} else {
-			oldDepartments[dpID] = true
-		}
-	}
-
-	if needInsert {
-		query, args, err = qBuilder.PlaceholderFormat(sq.Dollar).ToSql()
-		if err != nil {
-			return fmt.Errorf("can't build sql: %s", err.Error())
+	var added, kept []dto.Membership
+	for _, m := range membershipsOf(departmentIDs, memberships) {
+		if _, err := uuid.Parse(m.DepartmentID); err != nil {
+			return apperror.BadRequest("wrong department id", err)
 		}
-
-		_, err = tx.Exec(ctx, query, args...)
-		if err != nil {
-			rollbackErr := tx.Rollback(ctx)
-			if rollbackErr != nil {
-				return fmt.Errorf("rollback err: %s, err: %s", rollbackErr.Error(), err.Error())
-			}
-
-			return err
+		if _, ok := oldDepartments[m.DepartmentID]; ok {
+			oldDepartments[m.DepartmentID] = true
+			kept = append(kept, m)
+		} else {
+			added = append(added, m)
 		}
 	}
 
-	//delete from connection table
+	//close memberships, they are kept as history. It goes first, as new
+	//primary membership may replace a closed one
 	var forDelete []string
 
 	for dID, inNew := range oldDepartments {
@@ -357,8 +1146,10 @@ func (r *Repository) Update(ctx context.Context, dto *dto.UpdateEmployee) error
 	}
 	if len(forDelete) > 0 {
 		query, args, err = sq.
-			Delete(employeeDepartmentTable).
-			Where(sq.Eq{"department_id": forDelete, "employee_id": employee.ID}).
+			Update(employeeDepartmentTable).
+			Set("valid_to", sq.Expr("now()")).
+			Where(sq.Eq{"department_id": forDelete, "employee_id": employeeID}).
+			Where("valid_to IS NULL").
 			PlaceholderFormat(sq.Dollar).
 			ToSql()
 		if err != nil {
@@ -367,43 +1158,42 @@ func (r *Repository) Update(ctx context.Context, dto *dto.UpdateEmployee) error
 
 		_, err = tx.Exec(ctx, query, args...)
 		if err != nil {
-			rollbackErr := tx.Rollback(ctx)
-			if rollbackErr != nil {
-				return fmt.Errorf("rollback err: %s, err: %s", rollbackErr.Error(), err.Error())
-			}
-
-			return err
+			return apperror.FromDB(err, "can't remove employee from departments")
 		}
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("can't commit tx: %s", err.Error())
+	if memberships != nil && len(kept) > 0 {
+		if err := updateMemberships(ctx, tx, employeeID, kept); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return insertMemberships(ctx, tx, employeeID, added)
 }
 
-func (r *Repository) Delete(ctx context.Context, dto *dto.DeleteEmployee) error {
-	if _, err := uuid.Parse(dto.ID); err == nil {
-		_, err := r.GetByID(ctx, dto.ID)
+// updateMemberships rewrites positions of current memberships.
+func updateMemberships(ctx context.Context, tx pgx.Tx, employeeID string, memberships []dto.Membership) error {
+	// primary flag is cleared first as it may move between memberships
+	sql := "UPDATE employee_department SET is_primary = false WHERE employee_id = $1 AND valid_to IS NULL AND is_primary"
+	if _, err := tx.Exec(ctx, sql, employeeID); err != nil {
+		return apperror.FromDB(err, "can't update memberships")
+	}
+	for _, m := range memberships {
+		query, args, err := sq.
+			Update(employeeDepartmentTable).
+			Set("position", m.Position).
+			Set("fte", fteOf(m)).
+			Set("is_primary", m.Primary).
+			Where(sq.Eq{"employee_id": employeeID, "department_id": m.DepartmentID}).
+			Where("valid_to IS NULL").
+			PlaceholderFormat(sq.Dollar).
+			ToSql()
 		if err != nil {
-			return fmt.Errorf("employee not found: %s", err.Error())
+			return fmt.Errorf("can't build query: %s", err.Error())
+		}
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return apperror.FromDB(err, "can't update memberships")
 		}
-	} else {
-		return fmt.Errorf("wrong id: %s", err.Error())
-	}
-
-	query, args, err := sq.
-		Delete(employeeTable).
-		Where(sq.Eq{"employee_id": dto.ID}).
-		PlaceholderFormat(sq.Dollar).
-		ToSql()
-	if err != nil {
-		return fmt.Errorf("can't build query: %s", err.Error())
-	}
-	_, err = r.db.Exec(ctx, query, args...)
-	if err != nil {
-		return fmt.Errorf("sql exec err: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,250 @@
+package grant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/pgutil"
+	"github.com/google/uuid"
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// tables
+	grantTable = "role_grants"
+)
+
+type GrantRepo interface {
+	Create(ctx context.Context, req *dto.CreateGrant, grantedBy string) (dto.Grant, error)
+	GetByID(ctx context.Context, grantID string) (dto.Grant, error)
+	List(ctx context.Context, f *dto.ListGrants) ([]dto.Grant, int, error)
+	Delete(ctx context.Context, grantID string) error
+	Covering(ctx context.Context, subject string, departmentIDs []string) (map[string][]string, error)
+	SubjectRoles(ctx context.Context, subject string) ([]string, error)
+	SubjectDepartments(ctx context.Context, subject string) ([]string, error)
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func New(pool *pgxpool.Pool) *Repository {
+	return &Repository{db: pool}
+}
+
+var grantColumns = []string{"g.grant_id", "g.subject", "g.department_id", "g.role", "g.granted_by", "g.created_at"}
+
+func scanGrant(row pgx.Row) (dto.Grant, error) {
+	g := dto.Grant{}
+	err := row.Scan(&g.ID, &g.Subject, &g.DepartmentID, &g.Role, &g.GrantedBy, &g.CreatedAt)
+	return g, err
+}
+
+// Create grants role or replaces role of existing grant of subject on the
+// department.
+func (r *Repository) Create(ctx context.Context, req *dto.CreateGrant, grantedBy string) (dto.Grant, error) {
+	query, args, err := sq.
+		Insert(grantTable+" AS g").
+		Columns("grant_id", "subject", "department_id", "role", "granted_by").
+		Values(uuid.NewString(), req.Subject, req.DepartmentID, req.Role, grantedBy).
+		Suffix(`ON CONFLICT (subject, department_id) DO UPDATE
+			SET role = excluded.role, granted_by = excluded.granted_by, created_at = now()
+			RETURNING g.grant_id, g.subject, g.department_id, g.role, g.granted_by, g.created_at`).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.Grant{}, fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	g, err := scanGrant(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		return g, apperror.FromDB(err, "can't create grant")
+	}
+	return g, nil
+}
+
+func (r *Repository) GetByID(ctx context.Context, grantID string) (dto.Grant, error) {
+	if _, err := uuid.Parse(grantID); err != nil {
+		return dto.Grant{}, apperror.BadRequest("wrong grant id", err)
+	}
+	query, args, err := sq.
+		Select(grantColumns...).
+		From(grantTable + " g").
+		Where(sq.Eq{"g.grant_id": grantID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.Grant{}, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	g, err := scanGrant(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return g, apperror.NotFound("grant not found", err)
+		}
+		return g, fmt.Errorf("can't scan grant: %w", err)
+	}
+	return g, nil
+}
+
+func (r *Repository) List(ctx context.Context, f *dto.ListGrants) ([]dto.Grant, int, error) {
+	grants := []dto.Grant{}
+	filters := sq.And{}
+	if f.Subject != "" {
+		filters = append(filters, sq.Eq{"g.subject": f.Subject})
+	}
+	if f.DepartmentID != "" {
+		filters = append(filters, sq.Expr(`d.department_path <@
+			(SELECT department_path FROM departments WHERE department_id = ?)`, f.DepartmentID))
+	}
+
+	query, args, err := sq.
+		Select("count(*)").
+		From(grantTable + " g").
+		Join("departments d ON d.department_id = g.department_id").
+		Where(filters).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return grants, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	var total int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return grants, 0, fmt.Errorf("can't count grants: %s", err.Error())
+	}
+
+	b := sq.
+		Select(grantColumns...).
+		From(grantTable+" g").
+		Join("departments d ON d.department_id = g.department_id").
+		Where(filters).
+		OrderBy("d.department_path", "g.subject")
+	query, args, err = pgutil.Paginate(b, f.Limit, f.Offset).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return grants, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return grants, 0, fmt.Errorf("can't select grants: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g, err := scanGrant(rows)
+		if err != nil {
+			return grants, 0, fmt.Errorf("can't scan grant: %s", err.Error())
+		}
+		grants = append(grants, g)
+	}
+	return grants, total, nil
+}
+
+func (r *Repository) Delete(ctx context.Context, grantID string) error {
+	if _, err := uuid.Parse(grantID); err != nil {
+		return apperror.BadRequest("wrong grant id", err)
+	}
+	query, args, err := sq.
+		Delete(grantTable).
+		Where(sq.Eq{"grant_id": grantID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	tag, err := r.db.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't delete grant: %s", err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.NotFound("grant not found", nil)
+	}
+	return nil
+}
+
+// Covering returns roles of subject granted on each of departments or on
+// any of their ancestors, by department id.
+func (r *Repository) Covering(ctx context.Context, subject string, departmentIDs []string) (map[string][]string, error) {
+	roles := make(map[string][]string)
+	sql := `SELECT d.department_id::text, g.role
+		FROM departments d
+		JOIN departments gd ON gd.department_path @> d.department_path
+		JOIN role_grants g ON g.department_id = gd.department_id
+		WHERE g.subject = $1 AND d.department_id = ANY($2::uuid[])`
+	rows, err := r.db.Query(ctx, sql, subject, departmentIDs)
+	if err != nil {
+		return roles, apperror.FromDB(err, "can't select roles")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, role string
+		if err := rows.Scan(&id, &role); err != nil {
+			return roles, fmt.Errorf("can't scan role: %s", err.Error())
+		}
+		roles[id] = append(roles[id], role)
+	}
+	if err := rows.Err(); err != nil {
+		return roles, apperror.FromDB(err, "can't select roles")
+	}
+	return roles, nil
+}
+
+// SubjectRoles returns distinct roles subject has anywhere.
+func (r *Repository) SubjectRoles(ctx context.Context, subject string) ([]string, error) {
+	roles := []string{}
+	query, args, err := sq.
+		Select("DISTINCT role").
+		From(grantTable).
+		Where(sq.Eq{"subject": subject}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return roles, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return roles, fmt.Errorf("can't select roles: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return roles, fmt.Errorf("can't scan role: %s", err.Error())
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// SubjectDepartments returns departments subject has any role on, roles
+// hold in their subtrees too.
+func (r *Repository) SubjectDepartments(ctx context.Context, subject string) ([]string, error) {
+	ids := []string{}
+	query, args, err := sq.
+		Select("department_id").
+		From(grantTable).
+		Where(sq.Eq{"subject": subject}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return ids, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return ids, fmt.Errorf("can't select departments: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return ids, fmt.Errorf("can't scan department: %s", err.Error())
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,198 @@
+// Package outbox writes change events in the transaction of the change, so
+// an event is published if and only if the change is committed.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/pgutil"
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// tables
+	outboxTable = "outbox_events"
+	// notification channel, see migration 00009_outbox_notify
+	notifyChannel = "outbox_events"
+)
+
+var eventColumns = []string{"event_id", "event_type", "entity_id", "created_at", "data"}
+
+// OutboxRepo reads published events.
+type OutboxRepo interface {
+	GetByID(ctx context.Context, eventID int64) (dto.Event, error)
+	After(ctx context.Context, eventID int64, limit int) ([]dto.Event, error)
+	Listen(ctx context.Context, notify func(eventID int64)) error
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func New(pool *pgxpool.Pool) *Repository {
+	return &Repository{db: pool}
+}
+
+// Publish writes event about entity, data is sent to subscribers as is.
+func Publish(ctx context.Context, q pgutil.Querier, eventType, entityID string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("can't marshal event data: %s", err.Error())
+	}
+	query, args, err := sq.
+		Insert(outboxTable).
+		Columns("event_type", "entity_id", "data").
+		Values(eventType, entityID, b).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build query: %s", err.Error())
+	}
+	if _, err := q.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't write outbox event: %s", err.Error())
+	}
+	return nil
+}
+
+// Change is data of entity events, nil Before or After means that entity
+// was created or deleted.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Membership is data of membership.changed event.
+type Membership struct {
+	EmployeeID string   `json:"employee_id"`
+	Before     []string `json:"before"`
+	After      []string `json:"after"`
+}
+
+// MembershipChanged publishes membership.changed if sorted department ids of
+// employee differ.
+func MembershipChanged(ctx context.Context, q pgutil.Querier, employeeID string, before, after []string) error {
+	if before == nil {
+		before = []string{}
+	}
+	if after == nil {
+		after = []string{}
+	}
+	if equal(before, after) {
+		return nil
+	}
+	return Publish(ctx, q, dto.EventMembershipChanged, employeeID,
+		Membership{EmployeeID: employeeID, Before: before, After: after})
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Repository) GetByID(ctx context.Context, eventID int64) (dto.Event, error) {
+	query, args, err := sq.
+		Select(eventColumns...).
+		From(outboxTable).
+		Where(sq.Eq{"event_id": eventID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.Event{}, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	e, err := scanEvent(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return e, apperror.NotFound("event not found", err)
+		}
+		return e, fmt.Errorf("can't scan event: %w", err)
+	}
+	return e, nil
+}
+
+// After returns up to limit events following eventID in order of ids.
+func (r *Repository) After(ctx context.Context, eventID int64, limit int) ([]dto.Event, error) {
+	events := []dto.Event{}
+	query, args, err := sq.
+		Select(eventColumns...).
+		From(outboxTable).
+		Where(sq.Gt{"event_id": eventID}).
+		OrderBy("event_id").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return events, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return events, fmt.Errorf("can't select events: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return events, fmt.Errorf("can't scan event: %s", err.Error())
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Listen calls notify with id of every event committed after it started,
+// it holds one pool connection and blocks until ctx is done or the
+// connection fails.
+func (r *Repository) Listen(ctx context.Context, notify func(eventID int64)) error {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("can't acquire connection: %s", err.Error())
+	}
+	defer func() {
+		// connection goes back to the pool, it is closed if wait was cancelled
+		conn.Exec(context.Background(), "UNLISTEN *")
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return fmt.Errorf("can't listen: %s", err.Error())
+	}
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("can't wait for notification: %s", err.Error())
+		}
+		id, err := strconv.ParseInt(n.Payload, 10, 64)
+		if err != nil {
+			return fmt.Errorf("wrong notification payload %q: %s", n.Payload, err.Error())
+		}
+		notify(id)
+	}
+}
+
+func scanEvent(row pgx.Row) (dto.Event, error) {
+	e := dto.Event{}
+	var data []byte
+	if err := row.Scan(&e.ID, &e.Type, &e.EntityID, &e.CreatedAt, &data); err != nil {
+		return e, err
+	}
+	e.Data = data
+	return e, nil
+}
@@ -0,0 +1,71 @@
+package pgutil
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LikePrefix builds LIKE pattern matching values starting with prefix.
+func LikePrefix(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+// OrderBy converts sort key like "name" or "-name" to ORDER BY clause
+// using allowed columns. Unknown keys fall back to def.
+func OrderBy(sort string, columns map[string]string, def string) string {
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	column, ok := columns[sort]
+	if !ok {
+		return def
+	}
+	return column + " " + direction
+}
+
+// Paginate applies limit and offset. Page is never unbounded: limit out of
+// range falls back to default page size or to the maximum one.
+func Paginate(b sq.SelectBuilder, limit, offset int) sq.SelectBuilder {
+	switch {
+	case limit <= 0:
+		limit = dto.DefaultPageLimit
+	case limit > dto.MaxPageLimit:
+		limit = dto.MaxPageLimit
+	}
+	b = b.Limit(uint64(limit))
+	if offset > 0 {
+		b = b.Offset(uint64(offset))
+	}
+	return b
+}
+
+// DepartmentFullPath joins names of all ancestors of department aliased as d
+// like "Software department / Web department".
+const DepartmentFullPath = `(SELECT string_agg(a.department_name, ' / ' ORDER BY nlevel(a.department_path))
+	FROM departments a WHERE a.department_path @> d.department_path)`
+
+// MembershipAt selects memberships aliased as alias that were valid at t,
+// zero t selects current ones.
+func MembershipAt(alias string, t time.Time) sq.Sqlizer {
+	if t.IsZero() {
+		return sq.Expr(alias + ".valid_to IS NULL")
+	}
+	return sq.Expr(alias+".valid_from <= ? AND ("+alias+".valid_to IS NULL OR "+alias+".valid_to > ?)", t, t)
+}
+
+// Querier is implemented by both connection pool and transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
@@ -0,0 +1,258 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/pgutil"
+	"github.com/google/uuid"
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// tables
+	scheduleTable = "scheduled_changes"
+)
+
+var changeColumns = []string{"change_id", "kind", "payload", "effective_at", "status",
+	"created_by", "created_at", "applied_at", "error", "attempts"}
+
+type ScheduleRepo interface {
+	Create(ctx context.Context, req *dto.CreateScheduledChange, createdBy string) (dto.ScheduledChange, error)
+	GetByID(ctx context.Context, changeID string) (dto.ScheduledChange, error)
+	List(ctx context.Context, f *dto.ListScheduledChanges, departmentIDs []string) ([]dto.ScheduledChange, int, error)
+	Cancel(ctx context.Context, changeID string) (dto.ScheduledChange, error)
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (dto.ScheduledChange, bool, error)
+	Finish(ctx context.Context, c dto.ScheduledChange, applyErr error) error
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func New(pool *pgxpool.Pool) *Repository {
+	return &Repository{db: pool}
+}
+
+// payload keeps kind specific fields of change.
+type payload struct {
+	DepartmentID string   `json:"department_id,omitempty"`
+	ParentID     string   `json:"parent_id,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	EmployeeID   string   `json:"employee_id,omitempty"`
+	Departments  []string `json:"departments_ids,omitempty"`
+}
+
+func (r *Repository) Create(ctx context.Context, req *dto.CreateScheduledChange, createdBy string) (dto.ScheduledChange, error) {
+	p, err := json.Marshal(payload{
+		DepartmentID: req.DepartmentID,
+		ParentID:     req.ParentID,
+		Name:         req.Name,
+		EmployeeID:   req.EmployeeID,
+		Departments:  req.Departments,
+	})
+	if err != nil {
+		return dto.ScheduledChange{}, fmt.Errorf("can't marshal payload: %s", err.Error())
+	}
+
+	query, args, err := sq.
+		Insert(scheduleTable).
+		Columns("change_id", "kind", "payload", "effective_at", "created_by").
+		Values(uuid.NewString(), req.Kind, p, req.EffectiveAt, createdBy).
+		Suffix("RETURNING " + columnList()).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.ScheduledChange{}, fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	c, err := scanChange(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		return c, apperror.FromDB(err, "can't schedule change")
+	}
+	return c, nil
+}
+
+func (r *Repository) GetByID(ctx context.Context, changeID string) (dto.ScheduledChange, error) {
+	if _, err := uuid.Parse(changeID); err != nil {
+		return dto.ScheduledChange{}, apperror.BadRequest("wrong change id", err)
+	}
+	query, args, err := sq.
+		Select(changeColumns...).
+		From(scheduleTable).
+		Where(sq.Eq{"change_id": changeID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.ScheduledChange{}, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	c, err := scanChange(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c, apperror.NotFound("scheduled change not found", err)
+		}
+		return c, fmt.Errorf("can't scan scheduled change: %w", err)
+	}
+	return c, nil
+}
+
+// List returns page of changes, non-nil departmentIDs limit them to changes
+// touching subtrees of these departments: changed, new parent, new
+// departments of employee or the ones employee is in now.
+func (r *Repository) List(ctx context.Context, f *dto.ListScheduledChanges, departmentIDs []string) ([]dto.ScheduledChange, int, error) {
+	changes := []dto.ScheduledChange{}
+	filters := sq.And{}
+	if f.Status != "" {
+		filters = append(filters, sq.Eq{"status": f.Status})
+	}
+	if departmentIDs != nil {
+		filters = append(filters, sq.Expr(`EXISTS (SELECT 1 FROM departments s_d
+			JOIN departments s_root ON s_d.department_path <@ s_root.department_path
+			WHERE s_root.department_id = ANY(?::uuid[]) AND (
+				s_d.department_id::text IN (payload->>'department_id', payload->>'parent_id')
+				OR s_d.department_id::text IN (SELECT jsonb_array_elements_text(coalesce(payload->'departments_ids', '[]')))
+				OR s_d.department_id IN (SELECT s_ed.department_id FROM employee_department s_ed
+					WHERE s_ed.employee_id::text = payload->>'employee_id' AND s_ed.valid_to IS NULL)))`,
+			departmentIDs))
+	}
+
+	query, args, err := sq.
+		Select("count(*)").
+		From(scheduleTable).
+		Where(filters).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return changes, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	var total int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return changes, 0, fmt.Errorf("can't count scheduled changes: %s", err.Error())
+	}
+
+	b := sq.
+		Select(changeColumns...).
+		From(scheduleTable).
+		Where(filters).
+		OrderBy("effective_at", "created_at", "change_id")
+	query, args, err = pgutil.Paginate(b, f.Limit, f.Offset).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return changes, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return changes, 0, fmt.Errorf("can't select scheduled changes: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanChange(rows)
+		if err != nil {
+			return changes, 0, fmt.Errorf("can't scan scheduled change: %s", err.Error())
+		}
+		changes = append(changes, c)
+	}
+	return changes, total, nil
+}
+
+// Cancel cancels change that is still pending.
+func (r *Repository) Cancel(ctx context.Context, changeID string) (dto.ScheduledChange, error) {
+	current, err := r.GetByID(ctx, changeID)
+	if err != nil {
+		return current, err
+	}
+
+	query, args, err := sq.
+		Update(scheduleTable).
+		Set("status", dto.ChangeCancelled).
+		Where(sq.Eq{"change_id": changeID, "status": dto.ChangePending}).
+		Suffix("RETURNING " + columnList()).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return current, fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	c, err := scanChange(r.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return current, apperror.Conflict("only pending change can be cancelled, change is "+current.Status, err)
+		}
+		return current, fmt.Errorf("can't cancel scheduled change: %w", err)
+	}
+	return c, nil
+}
+
+// ClaimDue marks the earliest pending change effective at now as applying
+// for lease and returns it, false means that nothing is due. Change whose
+// lease expired without result was interrupted and is claimed again. Locked
+// rows are skipped, so several service instances never claim the same change.
+func (r *Repository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (dto.ScheduledChange, bool, error) {
+	sql := `UPDATE scheduled_changes SET status = $1, claimed_at = now(), attempts = attempts + 1
+		WHERE change_id = (SELECT change_id FROM scheduled_changes
+			WHERE (status = $2 AND effective_at <= $3)
+				OR (status = $1 AND claimed_at < now() - $4 * interval '1 millisecond')
+			ORDER BY effective_at, created_at
+			LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING ` + columnList()
+	c, err := scanChange(r.db.QueryRow(ctx, sql, dto.ChangeApplying, dto.ChangePending, now, lease.Milliseconds()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c, false, nil
+		}
+		return c, false, fmt.Errorf("can't claim scheduled change: %s", err.Error())
+	}
+	return c, true, nil
+}
+
+// Finish records result of applying claimed change, only client safe part
+// of applyErr is kept. Result of a claim that expired and was taken by
+// another worker is ignored.
+func (r *Repository) Finish(ctx context.Context, c dto.ScheduledChange, applyErr error) error {
+	status, msg := dto.ChangeApplied, ""
+	if applyErr != nil {
+		status, msg = dto.ChangeFailed, apperror.MessageOf(applyErr)
+	}
+	query, args, err := sq.
+		Update(scheduleTable).
+		Set("status", status).
+		Set("applied_at", sq.Expr("now()")).
+		Set("error", msg).
+		Where(sq.Eq{"change_id": c.ID, "status": dto.ChangeApplying, "attempts": c.Attempts}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	if _, err := r.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't finish scheduled change: %s", err.Error())
+	}
+	return nil
+}
+
+func columnList() string {
+	return strings.Join(changeColumns, ", ")
+}
+
+func scanChange(row pgx.Row) (dto.ScheduledChange, error) {
+	c := dto.ScheduledChange{}
+	var raw []byte
+	err := row.Scan(&c.ID, &c.Kind, &raw, &c.EffectiveAt, &c.Status,
+		&c.CreatedBy, &c.CreatedAt, &c.AppliedAt, &c.Error, &c.Attempts)
+	if err != nil {
+		return c, err
+	}
+	p := payload{}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return c, fmt.Errorf("can't unmarshal payload: %s", err.Error())
+	}
+	c.DepartmentID, c.ParentID, c.Name = p.DepartmentID, p.ParentID, p.Name
+	c.EmployeeID, c.Departments = p.EmployeeID, p.Departments
+	return c, nil
+}
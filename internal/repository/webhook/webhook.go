@@ -0,0 +1,278 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/pgutil"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// tables
+	webhookTable  = "webhooks"
+	deliveryTable = "webhook_deliveries"
+)
+
+type WebhookRepo interface {
+	Create(ctx context.Context, req *dto.CreateWebhook) (dto.Webhook, error)
+	List(ctx context.Context) ([]dto.Webhook, error)
+	Delete(ctx context.Context, webhookID string) error
+	ListDeliveries(ctx context.Context, f *dto.ListDeliveries) ([]dto.WebhookDelivery, int, error)
+	FanOut(ctx context.Context, limit int) (int, error)
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]dto.PendingDelivery, error)
+	MarkDelivered(ctx context.Context, d dto.PendingDelivery, status int) error
+	MarkFailed(ctx context.Context, d dto.PendingDelivery, status int, msg string, next time.Time, dead bool) error
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func New(pool *pgxpool.Pool) *Repository {
+	return &Repository{db: pool}
+}
+
+func (r *Repository) Create(ctx context.Context, req *dto.CreateWebhook) (dto.Webhook, error) {
+	types := req.EventTypes
+	if types == nil {
+		types = []string{}
+	}
+	query, args, err := sq.
+		Insert(webhookTable).
+		Columns("webhook_id", "url", "secret", "event_types").
+		Values(uuid.NewString(), req.URL, req.Secret, types).
+		Suffix("RETURNING webhook_id, url, event_types, active, created_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return dto.Webhook{}, fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	w := dto.Webhook{}
+	err = r.db.QueryRow(ctx, query, args...).Scan(&w.ID, &w.URL, &w.EventTypes, &w.Active, &w.CreatedAt)
+	if err != nil {
+		return w, apperror.FromDB(err, "can't create webhook")
+	}
+	return w, nil
+}
+
+// List returns all webhooks, secrets are never read back.
+func (r *Repository) List(ctx context.Context) ([]dto.Webhook, error) {
+	webhooks := []dto.Webhook{}
+	query, args, err := sq.
+		Select("webhook_id", "url", "event_types", "active", "created_at").
+		From(webhookTable).
+		OrderBy("created_at", "webhook_id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return webhooks, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return webhooks, fmt.Errorf("can't select webhooks: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		w := dto.Webhook{}
+		if err := rows.Scan(&w.ID, &w.URL, &w.EventTypes, &w.Active, &w.CreatedAt); err != nil {
+			return webhooks, fmt.Errorf("can't scan webhook: %s", err.Error())
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, nil
+}
+
+// Delete removes webhook together with its deliveries.
+func (r *Repository) Delete(ctx context.Context, webhookID string) error {
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return apperror.BadRequest("wrong webhook id", err)
+	}
+	query, args, err := sq.
+		Delete(webhookTable).
+		Where(sq.Eq{"webhook_id": webhookID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	tag, err := r.db.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't delete webhook: %s", err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.NotFound("webhook not found", nil)
+	}
+	return nil
+}
+
+func (r *Repository) ListDeliveries(ctx context.Context, f *dto.ListDeliveries) ([]dto.WebhookDelivery, int, error) {
+	deliveries := []dto.WebhookDelivery{}
+	filters := sq.And{}
+	if f.WebhookID != "" {
+		filters = append(filters, sq.Eq{"d.webhook_id": f.WebhookID})
+	}
+	if f.Status != "" {
+		filters = append(filters, sq.Eq{"d.status": f.Status})
+	}
+
+	query, args, err := sq.
+		Select("count(*)").
+		From(deliveryTable + " d").
+		Where(filters).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return deliveries, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	var total int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return deliveries, 0, fmt.Errorf("can't count deliveries: %s", err.Error())
+	}
+
+	b := sq.
+		Select("d.webhook_id", "d.event_id", "e.event_type", "d.status", "d.attempts", "d.last_status",
+			"d.last_error", "d.next_attempt_at", "d.delivered_at", "d.created_at").
+		From(deliveryTable+" d").
+		Join("outbox_events e ON e.event_id = d.event_id").
+		Where(filters).
+		OrderBy("d.created_at DESC", "d.event_id DESC")
+	query, args, err = pgutil.Paginate(b, f.Limit, f.Offset).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return deliveries, 0, fmt.Errorf("can't build query: %s", err.Error())
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return deliveries, 0, fmt.Errorf("can't select deliveries: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := dto.WebhookDelivery{}
+		err := rows.Scan(&d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.LastStatus,
+			&d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt)
+		if err != nil {
+			return deliveries, 0, fmt.Errorf("can't scan delivery: %s", err.Error())
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, total, nil
+}
+
+// FanOut marks up to limit undispatched outbox events as dispatched and
+// creates a pending delivery of each of them for every active webhook
+// subscribed to its type. Returns amount of dispatched events.
+func (r *Repository) FanOut(ctx context.Context, limit int) (int, error) {
+	sql := `WITH events AS (
+			UPDATE outbox_events SET dispatched_at = now()
+			WHERE event_id IN (SELECT event_id FROM outbox_events
+				WHERE dispatched_at IS NULL
+				ORDER BY event_id
+				LIMIT $1 FOR UPDATE SKIP LOCKED)
+			RETURNING event_id, event_type
+		), deliveries AS (
+			INSERT INTO webhook_deliveries (webhook_id, event_id)
+			SELECT w.webhook_id, e.event_id FROM events e
+			JOIN webhooks w ON w.active
+				AND (cardinality(w.event_types) = 0 OR e.event_type = ANY(w.event_types))
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*) FROM events`
+	var n int
+	if err := r.db.QueryRow(ctx, sql, limit).Scan(&n); err != nil {
+		return 0, fmt.Errorf("can't fan out outbox events: %s", err.Error())
+	}
+	return n, nil
+}
+
+// ClaimDeliveries returns up to limit due pending deliveries in order of
+// events and postpones them by lease, so a delivery lost by a crashed
+// dispatcher is retried later and never sent by two dispatchers at once.
+func (r *Repository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]dto.PendingDelivery, error) {
+	deliveries := []dto.PendingDelivery{}
+	sql := `WITH claimed AS (
+			UPDATE webhook_deliveries d SET next_attempt_at = now() + $2 * interval '1 millisecond'
+			WHERE (d.webhook_id, d.event_id) IN (SELECT webhook_id, event_id FROM webhook_deliveries
+				WHERE status = $3 AND next_attempt_at <= now()
+				ORDER BY event_id
+				LIMIT $1 FOR UPDATE SKIP LOCKED)
+			RETURNING d.webhook_id, d.event_id, d.attempts
+		)
+		SELECT c.webhook_id, w.url, w.secret, c.attempts,
+			e.event_id, e.event_type, e.entity_id, e.created_at, e.data
+		FROM claimed c
+		JOIN webhooks w ON w.webhook_id = c.webhook_id
+		JOIN outbox_events e ON e.event_id = c.event_id
+		ORDER BY e.event_id`
+	rows, err := r.db.Query(ctx, sql, limit, lease.Milliseconds(), dto.DeliveryPending)
+	if err != nil {
+		return deliveries, fmt.Errorf("can't claim deliveries: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := dto.PendingDelivery{}
+		var data []byte
+		err := rows.Scan(&d.WebhookID, &d.URL, &d.Secret, &d.Attempts,
+			&d.Event.ID, &d.Event.Type, &d.Event.EntityID, &d.Event.CreatedAt, &data)
+		if err != nil {
+			return deliveries, fmt.Errorf("can't scan delivery: %s", err.Error())
+		}
+		d.Event.Data = data
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return deliveries, fmt.Errorf("can't claim deliveries: %s", err.Error())
+	}
+	return deliveries, nil
+}
+
+func (r *Repository) MarkDelivered(ctx context.Context, d dto.PendingDelivery, status int) error {
+	query, args, err := sq.
+		Update(deliveryTable).
+		Set("status", dto.DeliveryDelivered).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("last_status", status).
+		Set("last_error", "").
+		Set("delivered_at", sq.Expr("now()")).
+		Where(sq.Eq{"webhook_id": d.WebhookID, "event_id": d.Event.ID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	return r.exec(ctx, query, args)
+}
+
+// MarkFailed records failed attempt, the delivery is retried at next unless
+// it is dead.
+func (r *Repository) MarkFailed(ctx context.Context, d dto.PendingDelivery, status int, msg string, next time.Time, dead bool) error {
+	b := sq.
+		Update(deliveryTable).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("last_status", status).
+		Set("last_error", msg).
+		Set("next_attempt_at", next).
+		Where(sq.Eq{"webhook_id": d.WebhookID, "event_id": d.Event.ID})
+	if dead {
+		b = b.Set("status", dto.DeliveryDead)
+	}
+	query, args, err := b.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("can't build sql: %s", err.Error())
+	}
+	return r.exec(ctx, query, args)
+}
+
+func (r *Repository) exec(ctx context.Context, query string, args []interface{}) error {
+	if _, err := r.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't update delivery: %s", err.Error())
+	}
+	return nil
+}
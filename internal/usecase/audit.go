@@ -0,0 +1,27 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/audit"
+	"go.uber.org/zap"
+)
+
+type Audit struct {
+	log    *zap.SugaredLogger
+	rAudit audit.AuditRepo
+}
+
+func NewAudit(log *zap.SugaredLogger, rAudit audit.AuditRepo) *Audit {
+	return &Audit{log: log, rAudit: rAudit}
+}
+
+// GetEvents returns audit events newest first, audit of all departments
+// is for admins only.
+func (a Audit) GetEvents(ctx context.Context, f *dto.ListAudit) ([]dto.AuditEvent, int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return []dto.AuditEvent{}, 0, err
+	}
+	return a.rAudit.List(ctx, f)
+}
@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/auth"
+	"github.com/dimashiro/test_mediasoft/internal/identity"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/apikey"
+	"go.uber.org/zap"
+)
+
+const (
+	// apiKeyPrefix marks keys of the service, so leaked ones are easy to find
+	apiKeyPrefix = "gmk_"
+	apiKeyBytes  = 32
+	// shown part of key which tells keys apart
+	shownKeyLength = len(apiKeyPrefix) + 8
+	// subject of admin key from configuration
+	adminSubject = "admin"
+	// subjects of stored keys are this prefix and key id
+	apiKeySubjectPrefix = "key:"
+)
+
+// Auth authenticates callers by api keys or JWT bearer tokens and manages
+// api keys.
+type Auth struct {
+	log     *zap.SugaredLogger
+	rAPIKey apikey.APIKeyRepo
+	jwt     *auth.Verifier
+	// adminKeyHash is sha256 of admin key from configuration, empty if unset
+	adminKeyHash string
+}
+
+// NewAuth returns authenticator, adminKey is a bootstrap key with admin
+// rights that isn't stored in database, empty adminKey disables it.
+func NewAuth(log *zap.SugaredLogger, rAPIKey apikey.APIKeyRepo, jwt *auth.Verifier, adminKey string) *Auth {
+	a := &Auth{log: log, rAPIKey: rAPIKey, jwt: jwt}
+	if adminKey != "" {
+		a.adminKeyHash = hashAPIKey(adminKey)
+	}
+	return a
+}
+
+// Authenticate returns caller of api key or bearer token, whichever is set.
+func (a Auth) Authenticate(ctx context.Context, key, token string) (identity.Identity, error) {
+	switch {
+	case key != "":
+		return a.authenticateKey(ctx, key)
+	case token != "":
+		if !a.jwt.Enabled() {
+			return identity.Identity{}, apperror.Unauthorized("bearer tokens are not accepted", nil)
+		}
+		claims, err := a.jwt.Verify(token, time.Now())
+		if err != nil {
+			return identity.Identity{}, apperror.Unauthorized("invalid token", err)
+		}
+		return identity.Identity{Subject: claims.Subject, Method: identity.MethodJWT, Admin: claims.Admin}, nil
+	default:
+		return identity.Identity{}, apperror.Unauthorized("authentication required", nil)
+	}
+}
+
+func (a Auth) authenticateKey(ctx context.Context, key string) (identity.Identity, error) {
+	hash := hashAPIKey(key)
+	if a.adminKeyHash != "" && hmac.Equal([]byte(hash), []byte(a.adminKeyHash)) {
+		return identity.Identity{Subject: adminSubject, Method: identity.MethodAdminKey, Admin: true}, nil
+	}
+	k, err := a.rAPIKey.GetByHash(ctx, hash)
+	if err != nil {
+		if apperror.CodeOf(err) == apperror.CodeNotFound {
+			return identity.Identity{}, apperror.Unauthorized("invalid api key", nil)
+		}
+		return identity.Identity{}, err
+	}
+	// failed bookkeeping doesn't reject the caller
+	if err := a.rAPIKey.Touch(ctx, k.ID); err != nil {
+		a.log.Errorw("auth", "ERROR", err)
+	}
+	return identity.Identity{Subject: apiKeySubjectPrefix + k.ID, Method: identity.MethodAPIKey, Admin: k.Admin}, nil
+}
+
+// Identify returns current identity of subject for background jobs acting
+// on its behalf. Admin rights are resolved again: admin key from
+// configuration and stored keys with admin are admins, revoked keys are
+// forbidden and token subjects act by their grants only, since whether
+// their tokens say admin can't be known without a request.
+func (a Auth) Identify(ctx context.Context, subject string) (identity.Identity, error) {
+	id := identity.Identity{Subject: subject, Method: identity.MethodJob}
+	switch {
+	case subject == adminSubject:
+		if a.adminKeyHash == "" {
+			return id, apperror.Forbidden("admin key is no longer configured")
+		}
+		id.Admin = true
+	case strings.HasPrefix(subject, apiKeySubjectPrefix):
+		k, err := a.rAPIKey.GetByID(ctx, strings.TrimPrefix(subject, apiKeySubjectPrefix))
+		if err != nil {
+			if apperror.CodeOf(err) == apperror.CodeNotFound {
+				return id, apperror.Forbidden("api key of " + subject + " was revoked")
+			}
+			return id, err
+		}
+		id.Admin = k.Admin
+	}
+	return id, nil
+}
+
+// CreateAPIKey issues new key, it is returned only once.
+func (a Auth) CreateAPIKey(ctx context.Context, req *dto.CreateAPIKey) (dto.NewAPIKey, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return dto.NewAPIKey{}, err
+	}
+	buf := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return dto.NewAPIKey{}, fmt.Errorf("can't generate api key: %s", err.Error())
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	k, err := a.rAPIKey.Create(ctx, req, key[:shownKeyLength], hashAPIKey(key), identity.Actor(ctx))
+	if err != nil {
+		return dto.NewAPIKey{}, err
+	}
+	return dto.NewAPIKey{APIKey: k, Key: key}, nil
+}
+
+func (a Auth) GetAPIKeys(ctx context.Context) ([]dto.APIKey, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return []dto.APIKey{}, err
+	}
+	return a.rAPIKey.List(ctx)
+}
+
+func (a Auth) DeleteAPIKey(ctx context.Context, keyID string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	return a.rAPIKey.Delete(ctx, keyID)
+}
+
+// hashAPIKey returns hex of sha256 of key, keys are random enough for a
+// fast hash to be safe.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,197 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/identity"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/grant"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// roleRank orders roles, a role allows everything lower ones do.
+var roleRank = map[string]int{
+	dto.RoleViewer: 1,
+	dto.RoleEditor: 2,
+	dto.RoleAdmin:  3,
+}
+
+// Authorizer checks roles of caller. Role granted on department holds in
+// its whole subtree, callers with admin identity are allowed everything.
+type Authorizer struct {
+	log    *zap.SugaredLogger
+	rGrant grant.GrantRepo
+}
+
+func NewAuthorizer(log *zap.SugaredLogger, rGrant grant.GrantRepo) *Authorizer {
+	return &Authorizer{log: log, rGrant: rGrant}
+}
+
+// Require checks that caller has at least role on every department.
+func (a Authorizer) Require(ctx context.Context, role string, departmentIDs ...string) error {
+	return a.require(ctx, role, departmentIDs, true)
+}
+
+// RequireOneOf checks that caller has at least role on one of departments.
+func (a Authorizer) RequireOneOf(ctx context.Context, role string, departmentIDs []string) error {
+	return a.require(ctx, role, departmentIDs, false)
+}
+
+func (a Authorizer) require(ctx context.Context, role string, departmentIDs []string, all bool) error {
+	id, ok := identity.FromContext(ctx)
+	if ok && id.Admin {
+		return nil
+	}
+	forbidden := apperror.Forbidden(role + " role on the department is required")
+	if !ok || len(departmentIDs) == 0 {
+		return forbidden
+	}
+	for _, dpID := range departmentIDs {
+		if _, err := uuid.Parse(dpID); err != nil {
+			return apperror.BadRequest("wrong department id", err)
+		}
+	}
+	roles, err := a.rGrant.Covering(ctx, id.Subject, departmentIDs)
+	if err != nil {
+		return err
+	}
+	for _, dpID := range departmentIDs {
+		allowed := maxRank(roles[dpID]) >= roleRank[role]
+		if allowed && !all {
+			return nil
+		}
+		if !allowed && all {
+			return forbidden
+		}
+	}
+	if all {
+		return nil
+	}
+	return forbidden
+}
+
+// RequireSomewhere checks that caller has at least role on any department,
+// it guards lists that span all departments.
+func (a Authorizer) RequireSomewhere(ctx context.Context, role string) error {
+	id, ok := identity.FromContext(ctx)
+	if ok && id.Admin {
+		return nil
+	}
+	forbidden := apperror.Forbidden(role + " role on some department is required")
+	if !ok {
+		return forbidden
+	}
+	roles, err := a.rGrant.SubjectRoles(ctx, id.Subject)
+	if err != nil {
+		return err
+	}
+	if maxRank(roles) < roleRank[role] {
+		return forbidden
+	}
+	return nil
+}
+
+// ViewScope returns departments in whose subtrees caller may view, all is
+// true for admins who may view everything. Caller without any role is
+// forbidden.
+func (a Authorizer) ViewScope(ctx context.Context) (departmentIDs []string, all bool, err error) {
+	id, ok := identity.FromContext(ctx)
+	if ok && id.Admin {
+		return nil, true, nil
+	}
+	forbidden := apperror.Forbidden(dto.RoleViewer + " role on some department is required")
+	if !ok {
+		return nil, false, forbidden
+	}
+	// every role allows viewing
+	ids, err := a.rGrant.SubjectDepartments(ctx, id.Subject)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(ids) == 0 {
+		return nil, false, forbidden
+	}
+	return ids, false, nil
+}
+
+// RequireAdmin checks that caller is admin of the whole service.
+func (a Authorizer) RequireAdmin(ctx context.Context) error {
+	return requireAdmin(ctx)
+}
+
+func requireAdmin(ctx context.Context) error {
+	if id, ok := identity.FromContext(ctx); !ok || !id.Admin {
+		return apperror.Forbidden("admin rights required")
+	}
+	return nil
+}
+
+// requireParent checks right to put department under parentID, empty
+// parentID means root, which only admins may add.
+func (a Authorizer) requireParent(ctx context.Context, parentID string) error {
+	if parentID == "" {
+		return requireAdmin(ctx)
+	}
+	return a.Require(ctx, dto.RoleEditor, parentID)
+}
+
+func maxRank(roles []string) int {
+	max := 0
+	for _, r := range roles {
+		if roleRank[r] > max {
+			max = roleRank[r]
+		}
+	}
+	return max
+}
+
+// CreateGrant needs admin role on the department, so grants are managed
+// within own subtree only.
+func (a Authorizer) CreateGrant(ctx context.Context, req *dto.CreateGrant) (dto.Grant, error) {
+	req.Subject = strings.TrimSpace(req.Subject)
+	if err := a.Require(ctx, dto.RoleAdmin, req.DepartmentID); err != nil {
+		return dto.Grant{}, err
+	}
+	g, err := a.rGrant.Create(ctx, req, identity.Actor(ctx))
+	if err != nil {
+		return g, err
+	}
+	a.log.Infow("role granted", "subject", g.Subject, "department", g.DepartmentID, "role", g.Role,
+		"actor", identity.Actor(ctx))
+	return g, nil
+}
+
+// GetGrants lists own grants of caller, grants within subtree where caller
+// is admin, or any grants for admins.
+func (a Authorizer) GetGrants(ctx context.Context, f *dto.ListGrants) ([]dto.Grant, int, error) {
+	switch {
+	case requireAdmin(ctx) == nil:
+	case f.Subject != "" && f.Subject == identity.Actor(ctx):
+	case f.DepartmentID != "":
+		if err := a.Require(ctx, dto.RoleAdmin, f.DepartmentID); err != nil {
+			return []dto.Grant{}, 0, err
+		}
+	default:
+		return []dto.Grant{}, 0, apperror.Forbidden("department_id of administered department or own subject is required")
+	}
+	return a.rGrant.List(ctx, f)
+}
+
+func (a Authorizer) DeleteGrant(ctx context.Context, grantID string) error {
+	g, err := a.rGrant.GetByID(ctx, grantID)
+	if err != nil {
+		return err
+	}
+	if err := a.Require(ctx, dto.RoleAdmin, g.DepartmentID); err != nil {
+		return err
+	}
+	if err := a.rGrant.Delete(ctx, grantID); err != nil {
+		return err
+	}
+	a.log.Infow("role revoked", "subject", g.Subject, "department", g.DepartmentID, "role", g.Role,
+		"actor", identity.Actor(ctx))
+	return nil
+}
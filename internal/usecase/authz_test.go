@@ -0,0 +1,637 @@
+package usecase_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/auth"
+	"github.com/dimashiro/test_mediasoft/internal/handler"
+	"github.com/dimashiro/test_mediasoft/internal/identity"
+	"github.com/dimashiro/test_mediasoft/internal/model"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/department"
+	"github.com/dimashiro/test_mediasoft/internal/repository/employee"
+	"github.com/dimashiro/test_mediasoft/internal/usecase"
+	"go.uber.org/zap"
+)
+
+// Departments of the tests: A with child A1 and grandchild A1X, sibling
+// root B.
+const (
+	dpA   = "0a000000-0000-4000-8000-000000000000"
+	dpA1  = "0a100000-0000-4000-8000-000000000000"
+	dpA1X = "0a1f0000-0000-4000-8000-000000000000"
+	dpB   = "0b000000-0000-4000-8000-000000000000"
+)
+
+var departmentPaths = map[string]string{
+	dpA:   "a",
+	dpA1:  "a.a1",
+	dpA1X: "a.a1.x",
+	dpB:   "b",
+}
+
+// fakeGrantRepo keeps grants in memory, roles are inherited by paths of
+// departmentPaths like ltree does.
+type fakeGrantRepo struct {
+	mu     sync.Mutex
+	grants []dto.Grant
+}
+
+func (r *fakeGrantRepo) grant(subject, departmentID, role string) {
+	r.grants = append(r.grants, dto.Grant{ID: subject + departmentID, Subject: subject,
+		DepartmentID: departmentID, Role: role})
+}
+
+func (r *fakeGrantRepo) Create(ctx context.Context, req *dto.CreateGrant, grantedBy string) (dto.Grant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g := dto.Grant{ID: req.Subject + req.DepartmentID, Subject: req.Subject, DepartmentID: req.DepartmentID,
+		Role: req.Role, GrantedBy: grantedBy, CreatedAt: time.Now()}
+	r.grants = append(r.grants, g)
+	return g, nil
+}
+
+func (r *fakeGrantRepo) GetByID(ctx context.Context, grantID string) (dto.Grant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range r.grants {
+		if g.ID == grantID {
+			return g, nil
+		}
+	}
+	return dto.Grant{}, apperror.NotFound("grant not found", nil)
+}
+
+func (r *fakeGrantRepo) List(ctx context.Context, f *dto.ListGrants) ([]dto.Grant, int, error) {
+	return []dto.Grant{}, 0, nil
+}
+
+func (r *fakeGrantRepo) Delete(ctx context.Context, grantID string) error {
+	return nil
+}
+
+func (r *fakeGrantRepo) Covering(ctx context.Context, subject string, departmentIDs []string) (map[string][]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	roles := make(map[string][]string)
+	for _, id := range departmentIDs {
+		path := departmentPaths[id]
+		for _, g := range r.grants {
+			gPath := departmentPaths[g.DepartmentID]
+			if g.Subject == subject && (path == gPath || strings.HasPrefix(path, gPath+".")) {
+				roles[id] = append(roles[id], g.Role)
+			}
+		}
+	}
+	return roles, nil
+}
+
+func (r *fakeGrantRepo) SubjectRoles(ctx context.Context, subject string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	roles := []string{}
+	for _, g := range r.grants {
+		if g.Subject == subject {
+			roles = append(roles, g.Role)
+		}
+	}
+	return roles, nil
+}
+
+func (r *fakeGrantRepo) SubjectDepartments(ctx context.Context, subject string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []string{}
+	for _, g := range r.grants {
+		if g.Subject == subject {
+			ids = append(ids, g.DepartmentID)
+		}
+	}
+	return ids, nil
+}
+
+func caller(subject string) context.Context {
+	return identity.WithIdentity(context.Background(), identity.Identity{Subject: subject, Method: identity.MethodJWT})
+}
+
+func newAuthorizer() (*usecase.Authorizer, *fakeGrantRepo) {
+	grants := &fakeGrantRepo{}
+	grants.grant("viewer", dpA, dto.RoleViewer)
+	grants.grant("editor", dpA1, dto.RoleEditor)
+	grants.grant("admin-a", dpA, dto.RoleAdmin)
+	return usecase.NewAuthorizer(zap.NewNop().Sugar(), grants), grants
+}
+
+func wantForbidden(t *testing.T, err error) {
+	t.Helper()
+	if apperror.CodeOf(err) != apperror.CodeForbidden {
+		t.Errorf("err = %v, want forbidden", err)
+	}
+}
+
+func wantAllowed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Errorf("err = %v, want nil", err)
+	}
+}
+
+func TestRoleIsInheritedBySubtree(t *testing.T) {
+	a, _ := newAuthorizer()
+
+	wantAllowed(t, a.Require(caller("viewer"), dto.RoleViewer, dpA))
+	wantAllowed(t, a.Require(caller("viewer"), dto.RoleViewer, dpA1))
+	wantAllowed(t, a.Require(caller("viewer"), dto.RoleViewer, dpA1X))
+	wantAllowed(t, a.Require(caller("editor"), dto.RoleEditor, dpA1X))
+	// role doesn't go up the tree
+	wantForbidden(t, a.Require(caller("editor"), dto.RoleEditor, dpA))
+	// higher role allows what lower ones do
+	wantAllowed(t, a.Require(caller("admin-a"), dto.RoleViewer, dpA1X))
+	wantAllowed(t, a.Require(caller("admin-a"), dto.RoleEditor, dpA1))
+}
+
+func TestSiblingSubtreeIsDenied(t *testing.T) {
+	a, _ := newAuthorizer()
+
+	wantForbidden(t, a.Require(caller("viewer"), dto.RoleViewer, dpB))
+	wantForbidden(t, a.Require(caller("admin-a"), dto.RoleViewer, dpB))
+	// every department must be allowed
+	wantForbidden(t, a.Require(caller("admin-a"), dto.RoleViewer, dpA1, dpB))
+	wantAllowed(t, a.RequireOneOf(caller("admin-a"), dto.RoleViewer, []string{dpB, dpA1}))
+	wantForbidden(t, a.RequireOneOf(caller("editor"), dto.RoleViewer, []string{dpA, dpB}))
+}
+
+func TestViewerCannotWrite(t *testing.T) {
+	a, _ := newAuthorizer()
+
+	wantForbidden(t, a.Require(caller("viewer"), dto.RoleEditor, dpA1))
+	wantForbidden(t, a.Require(caller("viewer"), dto.RoleAdmin, dpA1))
+	wantAllowed(t, a.Require(caller("editor"), dto.RoleEditor, dpA1))
+	wantForbidden(t, a.Require(caller("editor"), dto.RoleAdmin, dpA1))
+
+	_, err := a.CreateGrant(caller("editor"), &dto.CreateGrant{Subject: "x", DepartmentID: dpA1, Role: dto.RoleViewer})
+	wantForbidden(t, err)
+	_, err = a.CreateGrant(caller("admin-a"), &dto.CreateGrant{Subject: "x", DepartmentID: dpA1, Role: dto.RoleViewer})
+	wantAllowed(t, err)
+}
+
+func TestAdminBypassesGrants(t *testing.T) {
+	a, _ := newAuthorizer()
+	ctx := identity.WithIdentity(context.Background(), identity.Identity{Subject: "root", Admin: true})
+
+	wantAllowed(t, a.Require(ctx, dto.RoleAdmin, dpA, dpB))
+	wantAllowed(t, a.RequireOneOf(ctx, dto.RoleAdmin, nil))
+	wantAllowed(t, a.RequireSomewhere(ctx, dto.RoleAdmin))
+	wantAllowed(t, a.RequireAdmin(ctx))
+	wantAllowed(t, a.RequireAdmin(identity.WithActor(context.Background(), "scheduler")))
+
+	// admin role on department doesn't make admin of the service
+	wantForbidden(t, a.RequireAdmin(caller("admin-a")))
+}
+
+func TestCallerWithoutRoles(t *testing.T) {
+	a, _ := newAuthorizer()
+
+	for _, ctx := range []context.Context{context.Background(), caller("nobody")} {
+		wantForbidden(t, a.Require(ctx, dto.RoleViewer, dpA))
+		wantForbidden(t, a.RequireSomewhere(ctx, dto.RoleViewer))
+		_, _, err := a.ViewScope(ctx)
+		wantForbidden(t, err)
+	}
+	wantAllowed(t, a.RequireSomewhere(caller("viewer"), dto.RoleViewer))
+	wantForbidden(t, a.RequireSomewhere(caller("viewer"), dto.RoleEditor))
+}
+
+func TestViewScope(t *testing.T) {
+	a, _ := newAuthorizer()
+
+	ids, all, err := a.ViewScope(caller("editor"))
+	wantAllowed(t, err)
+	if all || !reflect.DeepEqual(ids, []string{dpA1}) {
+		t.Errorf("scope = %v, %v, want [%s]", ids, all, dpA1)
+	}
+	_, all, err = a.ViewScope(identity.WithIdentity(context.Background(), identity.Identity{Subject: "root", Admin: true}))
+	wantAllowed(t, err)
+	if !all {
+		t.Error("admin scope isn't all")
+	}
+}
+
+// fakeAPIKeyRepo knows keys by their names, key of name is "key-" + name
+// and its id is "id-" + name.
+type fakeAPIKeyRepo struct {
+	keys map[string]dto.APIKey
+}
+
+func newFakeAPIKeyRepo(names ...string) *fakeAPIKeyRepo {
+	r := &fakeAPIKeyRepo{keys: make(map[string]dto.APIKey)}
+	for _, name := range names {
+		sum := sha256.Sum256([]byte("key-" + name))
+		r.keys[hex.EncodeToString(sum[:])] = dto.APIKey{ID: "id-" + name, Name: name}
+	}
+	return r
+}
+
+func (r *fakeAPIKeyRepo) Create(ctx context.Context, req *dto.CreateAPIKey, prefix, hash, createdBy string) (dto.APIKey, error) {
+	return dto.APIKey{}, nil
+}
+
+func (r *fakeAPIKeyRepo) List(ctx context.Context) ([]dto.APIKey, error) {
+	return []dto.APIKey{}, nil
+}
+
+func (r *fakeAPIKeyRepo) Delete(ctx context.Context, keyID string) error {
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) GetByHash(ctx context.Context, hash string) (dto.APIKey, error) {
+	k, ok := r.keys[hash]
+	if !ok {
+		return k, apperror.NotFound("api key not found", nil)
+	}
+	return k, nil
+}
+
+func (r *fakeAPIKeyRepo) GetByID(ctx context.Context, keyID string) (dto.APIKey, error) {
+	for _, k := range r.keys {
+		if k.ID == keyID {
+			return k, nil
+		}
+	}
+	return dto.APIKey{}, apperror.NotFound("api key not found", nil)
+}
+
+// makeAdmin turns key of name into admin one.
+func (r *fakeAPIKeyRepo) makeAdmin(name string) {
+	for hash, k := range r.keys {
+		if k.Name == name {
+			k.Admin = true
+			r.keys[hash] = k
+		}
+	}
+}
+
+func (r *fakeAPIKeyRepo) Touch(ctx context.Context, keyID string) error {
+	return nil
+}
+
+// fakeDepartmentRepo fails updates that pass authorization as not found,
+// other methods aren't expected to be called.
+type fakeDepartmentRepo struct {
+	department.DepartmentRepo
+}
+
+func (r fakeDepartmentRepo) Update(ctx context.Context, req *dto.UpdateDepartment) error {
+	return apperror.NotFound("department not found", nil)
+}
+
+// fakeHierarchyRepo has departments of departmentPaths and remembers
+// requested scopes by method.
+type fakeHierarchyRepo struct {
+	fakeDepartmentRepo
+	scopes map[string][][]string
+}
+
+func (r *fakeHierarchyRepo) scope(method string, scope []string) {
+	if r.scopes == nil {
+		r.scopes = make(map[string][][]string)
+	}
+	r.scopes[method] = append(r.scopes[method], scope)
+}
+
+func (r *fakeHierarchyRepo) Hierarchy(ctx context.Context) (model.Hierarchy, error) {
+	h := model.Hierarchy{Departments: make(map[string]*model.Department)}
+	byPath := make(map[string]*model.Department)
+	for _, id := range []string{dpA, dpA1, dpA1X, dpB} {
+		dp := &model.Department{ID: id, Name: departmentPaths[id], Path: departmentPaths[id],
+			Children: []*model.Department{}}
+		h.Departments[id] = dp
+		byPath[dp.Path] = dp
+		if i := strings.LastIndex(dp.Path, "."); i >= 0 {
+			parent := byPath[dp.Path[:i]]
+			parent.Children = append(parent.Children, dp)
+		} else {
+			h.Roots = append(h.Roots, dp)
+		}
+	}
+	return h, nil
+}
+
+func (r *fakeHierarchyRepo) GetAll(ctx context.Context, f *dto.ListDepartments, departmentIDs []string) ([]dto.ViewAllDepartments, int, error) {
+	r.scope("GetAll", departmentIDs)
+	return []dto.ViewAllDepartments{}, 0, nil
+}
+
+func (r *fakeHierarchyRepo) Export(ctx context.Context, departmentIDs []string, fn func(dto.DepartmentExportRow) error) error {
+	r.scope("Export", departmentIDs)
+	return nil
+}
+
+func (r *fakeHierarchyRepo) MemberCounts(ctx context.Context, subtreePaths []string) (map[string]int, error) {
+	r.scope("MemberCounts", subtreePaths)
+	return map[string]int{}, nil
+}
+
+func TestDepartmentViewsAreScoped(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	authz, grants := newAuthorizer()
+	// grant inside another granted subtree adds nothing
+	grants.grant("editor", dpA1X, dto.RoleViewer)
+	roots := func(dps []*model.Department) []string {
+		ids := []string{}
+		for _, dp := range dps {
+			ids = append(ids, dp.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantRoots []string
+		wantScope []string
+		wantPaths []string
+	}{
+		{"viewer of subtree", caller("editor"), []string{dpA1}, []string{dpA1, dpA1X}, []string{"a.a1"}},
+		{"admin", identity.WithIdentity(context.Background(), identity.Identity{Subject: "root", Admin: true}),
+			[]string{dpA, dpB}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dptms := &fakeHierarchyRepo{}
+			d := usecase.NewDepartment(log, dptms, &fakeEmployeeRepo{}, authz)
+
+			h, err := d.HierarchyDepartment(tt.ctx)
+			if err != nil {
+				t.Fatalf("HierarchyDepartment: %v", err)
+			}
+			if got := roots(h); !reflect.DeepEqual(got, tt.wantRoots) {
+				t.Errorf("hierarchy roots = %v, want %v", got, tt.wantRoots)
+			}
+			nodes, err := d.OrgChart(tt.ctx, &dto.OrgChart{})
+			if err != nil {
+				t.Fatalf("OrgChart: %v", err)
+			}
+			if len(nodes) != len(tt.wantRoots) {
+				t.Errorf("org chart has %d roots, want %d", len(nodes), len(tt.wantRoots))
+			}
+			if _, _, err := d.GetAllDepartments(tt.ctx, &dto.ListDepartments{}); err != nil {
+				t.Fatalf("GetAllDepartments: %v", err)
+			}
+			if err := d.ExportDepartments(tt.ctx, func(dto.DepartmentExportRow) error { return nil }); err != nil {
+				t.Fatalf("ExportDepartments: %v", err)
+			}
+
+			want := map[string][][]string{
+				"GetAll":       {tt.wantScope},
+				"Export":       {tt.wantScope},
+				"MemberCounts": {tt.wantPaths},
+			}
+			if !reflect.DeepEqual(dptms.scopes, want) {
+				t.Errorf("scopes = %v, want %v", dptms.scopes, want)
+			}
+		})
+	}
+
+	d := usecase.NewDepartment(log, &fakeHierarchyRepo{}, &fakeEmployeeRepo{}, authz)
+	_, err := d.HierarchyDepartment(caller("nobody"))
+	wantForbidden(t, err)
+}
+
+// fakeEmployeeRepo lists, searches and exports nothing but one row and
+// remembers requested scopes by method, other methods aren't expected to be
+// called.
+type fakeEmployeeRepo struct {
+	employee.EmployeeRepo
+	scopes map[string][][]string
+}
+
+func (r *fakeEmployeeRepo) scope(method string, departmentIDs []string) {
+	if r.scopes == nil {
+		r.scopes = make(map[string][][]string)
+	}
+	r.scopes[method] = append(r.scopes[method], departmentIDs)
+}
+
+func (r *fakeEmployeeRepo) GetAll(ctx context.Context, f *dto.ListEmployees, departmentIDs []string) ([]model.Employee, int, error) {
+	r.scope("GetAll", departmentIDs)
+	return []model.Employee{{ID: "e", Name: "Ivan", Surname: "Petrov"}}, 1, nil
+}
+
+func (r *fakeEmployeeRepo) Search(ctx context.Context, f *dto.SearchEmployees, subtreePath string, departmentIDs []string) ([]dto.EmployeeSearchResult, error) {
+	r.scope("Search", departmentIDs)
+	return []dto.EmployeeSearchResult{{ID: "e", Name: "Ivan", Surname: "Petrov"}}, nil
+}
+
+// GetDepartments puts every employee to A1.
+func (r *fakeEmployeeRepo) GetDepartments(ctx context.Context, employeeID string) ([]dto.ViewEmployeeDepartment, error) {
+	return []dto.ViewEmployeeDepartment{{ID: dpA1}}, nil
+}
+
+func (r *fakeEmployeeRepo) Export(ctx context.Context, departmentIDs []string, fn func(dto.EmployeeExportRow) error) error {
+	r.scope("Export", departmentIDs)
+	return fn(dto.EmployeeExportRow{ID: "e", Name: "Ivan", Surname: "Petrov"})
+}
+
+func TestHandlersReturnForbidden(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	authz, grants := newAuthorizer()
+	// api keys authenticate as "key:" + id, not by their names
+	grants.grant("key:id-viewer", dpA, dto.RoleViewer)
+	grants.grant("key:id-editor", dpA, dto.RoleEditor)
+	grants.grant("key:id-admin-a", dpA, dto.RoleAdmin)
+	// grant by name of key gives nothing
+	grants.grant("key:nobody", dpA, dto.RoleAdmin)
+	empls := &fakeEmployeeRepo{}
+	router, err := handler.NewRouter(log, handler.Usecases{
+		Auth:       usecase.NewAuth(log, newFakeAPIKeyRepo("viewer", "editor", "admin-a", "nobody"), auth.NewVerifier("", nil, "", ""), ""),
+		Authz:      authz,
+		Department: usecase.NewDepartment(log, fakeDepartmentRepo{}, empls, authz),
+		Employee:   usecase.NewEmployee(log, empls, fakeDepartmentRepo{}, authz),
+	}, handler.Options{})
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	grantBody := func(departmentID string) string {
+		return `{"subject":"someone","department_id":"` + departmentID + `","role":"viewer"}`
+	}
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"anonymous", "", http.MethodGet, "/api/employees/export", "", http.StatusUnauthorized},
+		{"viewer writes", "viewer", http.MethodPatch, "/api/v2/departments/" + dpA1, `{"name":"New"}`, http.StatusForbidden},
+		// fake repository answers 404 once authorization passed
+		{"editor writes in subtree", "editor", http.MethodPatch, "/api/v2/departments/" + dpA1, `{"name":"New"}`, http.StatusNotFound},
+		{"editor writes in sibling", "editor", http.MethodPatch, "/api/v2/departments/" + dpB, `{"name":"New"}`, http.StatusForbidden},
+		{"viewer grants", "viewer", http.MethodPost, "/api/grants", grantBody(dpA1), http.StatusForbidden},
+		{"admin grants in subtree", "admin-a", http.MethodPost, "/api/grants", grantBody(dpA1X), http.StatusCreated},
+		{"admin grants in sibling", "admin-a", http.MethodPost, "/api/grants", grantBody(dpB), http.StatusForbidden},
+		{"export without roles", "nobody", http.MethodGet, "/api/employees/export", "", http.StatusForbidden},
+		{"export of viewer", "viewer", http.MethodGet, "/api/employees/export", "", http.StatusOK},
+		{"list without roles", "nobody", http.MethodGet, "/api/v2/employees", "", http.StatusForbidden},
+		{"list of viewer", "viewer", http.MethodGet, "/api/v2/employees", "", http.StatusOK},
+		{"search without roles", "nobody", http.MethodGet, "/api/employees/search?q=ivan", "", http.StatusForbidden},
+		{"search of viewer", "viewer", http.MethodGet, "/api/employees/search?q=ivan", "", http.StatusOK},
+		{"search of viewer in sibling", "viewer", http.MethodGet, "/api/employees/search?q=ivan&department_id=" + dpB, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", "key-"+tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// employees are limited to subtree of viewer
+	want := map[string][][]string{"Export": {{dpA}}, "GetAll": {{dpA}}, "Search": {{dpA}}}
+	if !reflect.DeepEqual(empls.scopes, want) {
+		t.Errorf("scopes = %v, want %v", empls.scopes, want)
+	}
+}
+
+// fakeScheduleRepo hands out its changes once and records their results
+// and requested scopes.
+type fakeScheduleRepo struct {
+	changes []dto.ScheduledChange
+	results map[string]error
+	scopes  [][]string
+}
+
+func (r *fakeScheduleRepo) Create(ctx context.Context, req *dto.CreateScheduledChange, createdBy string) (dto.ScheduledChange, error) {
+	return dto.ScheduledChange{}, nil
+}
+
+func (r *fakeScheduleRepo) GetByID(ctx context.Context, changeID string) (dto.ScheduledChange, error) {
+	for _, c := range r.changes {
+		if c.ID == changeID {
+			return c, nil
+		}
+	}
+	return dto.ScheduledChange{}, apperror.NotFound("scheduled change not found", nil)
+}
+
+func (r *fakeScheduleRepo) List(ctx context.Context, f *dto.ListScheduledChanges, departmentIDs []string) ([]dto.ScheduledChange, int, error) {
+	r.scopes = append(r.scopes, departmentIDs)
+	return r.changes, len(r.changes), nil
+}
+
+func (r *fakeScheduleRepo) Cancel(ctx context.Context, changeID string) (dto.ScheduledChange, error) {
+	return dto.ScheduledChange{}, nil
+}
+
+func (r *fakeScheduleRepo) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (dto.ScheduledChange, bool, error) {
+	if len(r.changes) == 0 {
+		return dto.ScheduledChange{}, false, nil
+	}
+	c := r.changes[0]
+	r.changes = r.changes[1:]
+	c.Attempts++
+	return c, true, nil
+}
+
+func (r *fakeScheduleRepo) Finish(ctx context.Context, c dto.ScheduledChange, applyErr error) error {
+	r.results[c.ID] = applyErr
+	return nil
+}
+
+func TestScheduledChangeUsesCurrentRolesOfCreator(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	authz, grants := newAuthorizer()
+	grants.grant("key:id-editor", dpA, dto.RoleEditor)
+	grants.grant("key:id-viewer", dpA, dto.RoleViewer)
+	keys := newFakeAPIKeyRepo("editor", "viewer", "root")
+	keys.makeAdmin("root")
+	empls := &fakeEmployeeRepo{}
+	dptm := usecase.NewDepartment(log, fakeDepartmentRepo{}, empls, authz)
+	rename := func(id, createdBy, departmentID string) dto.ScheduledChange {
+		return dto.ScheduledChange{ID: id, Kind: dto.ChangeDepartmentRename, DepartmentID: departmentID,
+			Name: "New", CreatedBy: createdBy}
+	}
+	repo := &fakeScheduleRepo{results: make(map[string]error)}
+	repo.changes = []dto.ScheduledChange{
+		rename("editor", "key:id-editor", dpA1),
+		rename("viewer", "key:id-viewer", dpA1),
+		rename("revoked", "key:id-gone", dpA1),
+		rename("admin key", "key:id-root", dpB),
+		rename("token without roles", "someone", dpB),
+	}
+	s := usecase.NewSchedule(log, repo, fakeDepartmentRepo{}, empls, dptm,
+		usecase.NewEmployee(log, empls, fakeDepartmentRepo{}, authz), authz,
+		usecase.NewAuth(log, keys, auth.NewVerifier("", nil, "", ""), ""))
+
+	if _, err := s.ApplyDue(context.Background()); err != nil {
+		t.Fatalf("ApplyDue: %v", err)
+	}
+	tests := []struct {
+		change string
+		want   apperror.Code
+	}{
+		// fake repository answers 404 once authorization passed
+		{"editor", apperror.CodeNotFound},
+		{"viewer", apperror.CodeForbidden},
+		{"revoked", apperror.CodeForbidden},
+		{"admin key", apperror.CodeNotFound},
+		{"token without roles", apperror.CodeForbidden},
+	}
+	for _, tt := range tests {
+		if got := apperror.CodeOf(repo.results[tt.change]); got != tt.want {
+			t.Errorf("change of %s: code = %v, want %v (%v)", tt.change, got, tt.want, repo.results[tt.change])
+		}
+	}
+}
+
+func TestScheduledChangesAreScoped(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	authz, _ := newAuthorizer()
+	empls := &fakeEmployeeRepo{}
+	repo := &fakeScheduleRepo{changes: []dto.ScheduledChange{
+		{ID: "in a", Kind: dto.ChangeDepartmentRename, DepartmentID: dpA1X, Name: "New"},
+		{ID: "in b", Kind: dto.ChangeDepartmentRename, DepartmentID: dpB, Name: "New"},
+		{ID: "into a", Kind: dto.ChangeDepartmentMove, DepartmentID: dpB, ParentID: dpA1},
+		{ID: "from a", Kind: dto.ChangeEmployeeTransfer, EmployeeID: "e", Departments: []string{dpB}},
+	}}
+	dptm := usecase.NewDepartment(log, fakeDepartmentRepo{}, empls, authz)
+	s := usecase.NewSchedule(log, repo, fakeDepartmentRepo{}, empls, dptm,
+		usecase.NewEmployee(log, empls, fakeDepartmentRepo{}, authz), authz,
+		usecase.NewAuth(log, newFakeAPIKeyRepo(), auth.NewVerifier("", nil, "", ""), ""))
+	// editor of A1 views its subtree only
+	ctx := caller("editor")
+
+	for _, id := range []string{"in a", "into a", "from a"} {
+		_, err := s.GetChange(ctx, id)
+		wantAllowed(t, err)
+	}
+	_, err := s.GetChange(ctx, "in b")
+	wantForbidden(t, err)
+	_, err = s.PreviewChange(ctx, "in b")
+	wantForbidden(t, err)
+
+	if _, _, err := s.GetChanges(ctx, &dto.ListScheduledChanges{}); err != nil {
+		t.Fatalf("GetChanges: %v", err)
+	}
+	if want := [][]string{{dpA1}}; !reflect.DeepEqual(repo.scopes, want) {
+		t.Errorf("list scopes = %v, want %v", repo.scopes, want)
+	}
+}
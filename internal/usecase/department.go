@@ -2,8 +2,10 @@ package usecase
 
 import (
 	"context"
+	"sort"
 	"strings"
 
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
 	"github.com/dimashiro/test_mediasoft/internal/model"
 	"github.com/dimashiro/test_mediasoft/internal/model/dto"
 	"github.com/dimashiro/test_mediasoft/internal/repository/department"
@@ -16,58 +18,344 @@ type Department struct {
 	log   *zap.SugaredLogger
 	rEmpl employee.EmployeeRepo
 	rDptm department.DepartmentRepo
+	authz *Authorizer
 }
 
-func NewDepartment(log *zap.SugaredLogger, rDptm department.DepartmentRepo, rEmpl employee.EmployeeRepo) *Department {
-	return &Department{log: log, rDptm: rDptm, rEmpl: rEmpl}
+func NewDepartment(log *zap.SugaredLogger, rDptm department.DepartmentRepo, rEmpl employee.EmployeeRepo,
+	authz *Authorizer) *Department {
+	return &Department{log: log, rDptm: rDptm, rEmpl: rEmpl, authz: authz}
 }
 
-func (d Department) CreateDepartment(ctx context.Context, dto *dto.CreateDepartment) (model.Department, error) {
-	dp, err := d.rDptm.Create(ctx, dto)
+// CreateDepartment needs editor role on parent, only admins add roots.
+func (d Department) CreateDepartment(ctx context.Context, req *dto.CreateDepartment) (model.Department, error) {
+	if err := d.authz.requireParent(ctx, req.ParentID); err != nil {
+		return model.Department{}, err
+	}
+	dp, err := d.rDptm.Create(ctx, req)
 	if err != nil {
 		return model.Department{}, err
 	}
 	return dp, nil
 }
 
-func (d Department) UpdateDepartment(ctx context.Context, dto *dto.UpdateDepartment) error {
-	err := d.rDptm.Update(context.Background(), dto)
+func (d Department) UpdateDepartment(ctx context.Context, req *dto.UpdateDepartment) error {
+	if req.ParentID != nil {
+		if err := d.authorizeMove(ctx, req.ID, *req.ParentID); err != nil {
+			return err
+		}
+	} else if err := d.authz.Require(ctx, dto.RoleEditor, req.ID); err != nil {
+		return err
+	}
+	err := d.rDptm.Update(ctx, req)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (d Department) MoveDepartment(ctx context.Context, req *dto.MoveDepartment) error {
+	if err := d.authorizeMove(ctx, req.ID, req.ParentID); err != nil {
+		return err
+	}
+	return d.rDptm.Move(ctx, req)
+}
+
+// authorizeMove needs editor role on department and on its new parent.
+func (d Department) authorizeMove(ctx context.Context, departmentID, parentID string) error {
+	if err := d.authz.Require(ctx, dto.RoleEditor, departmentID); err != nil {
+		return err
+	}
+	return d.authz.requireParent(ctx, parentID)
+}
+
+func (d Department) GetDepartment(ctx context.Context, departmentID string) (dto.ViewDepartment, error) {
+	if err := d.authz.Require(ctx, dto.RoleViewer, departmentID); err != nil {
+		return dto.ViewDepartment{}, err
+	}
+	dp, err := d.rDptm.GetByID(ctx, departmentID)
+	if err != nil {
+		return dto.ViewDepartment{}, err
+	}
+	counts, err := d.rDptm.GetViewByID(ctx, dp.ID)
+	if err != nil {
+		return dto.ViewDepartment{}, err
+	}
+	ancestors, err := d.rDptm.Ancestors(ctx, dp)
+	if err != nil {
+		return dto.ViewDepartment{}, err
+	}
+	children, err := d.rDptm.GetChildren(ctx, dp)
+	if err != nil {
+		return dto.ViewDepartment{}, err
+	}
+	head, err := employeeRef(ctx, d.rEmpl, dp.HeadID)
+	if err != nil {
+		return dto.ViewDepartment{}, err
+	}
+
+	view := dto.ViewDepartment{
+		ID:                         dp.ID,
+		Name:                       dp.Name,
+		Path:                       dp.Path,
+		Head:                       head,
+		Breadcrumbs:                make([]dto.DepartmentRef, 0, len(ancestors)),
+		Children:                   children,
+		EmployeesAmount:            counts.EmployeesAmount,
+		EmployeesAmountInHierarchy: counts.EmployeesAmountInHierarchy,
+		Version:                    dp.Version,
+	}
+	for _, a := range ancestors {
+		view.Breadcrumbs = append(view.Breadcrumbs, dto.DepartmentRef{ID: a.ID, Name: a.Name})
+	}
+	// breadcrumbs end with department itself, parent is right before it
+	if n := len(view.Breadcrumbs); n > 1 {
+		parent := view.Breadcrumbs[n-2]
+		view.Parent = &parent
+	}
+	return view, nil
+}
+
+// HierarchyDepartment returns department trees caller may view, subtrees
+// of granted departments are roots for callers who aren't admins.
 func (d Department) HierarchyDepartment(ctx context.Context) ([]*model.Department, error) {
-	m, err := d.rDptm.Hierarchy(ctx)
+	departmentIDs, all, err := d.authz.ViewScope(ctx)
 	if err != nil {
 		return []*model.Department{}, err
 	}
-	dps := []*model.Department{}
-	for _, v := range m {
-		if strings.ReplaceAll(v.ID, "-", "_") == v.Path {
-			dps = append(dps, v)
+	h, err := d.hierarchy(ctx)
+	if err != nil {
+		return []*model.Department{}, err
+	}
+	if all {
+		return h.Roots, nil
+	}
+	return visibleRoots(h, departmentIDs), nil
+}
+
+// visibleRoots returns departments of h with departmentIDs ordered by path,
+// leaving out those inside subtrees of others.
+func visibleRoots(h model.Hierarchy, departmentIDs []string) []*model.Department {
+	granted := make([]*model.Department, 0, len(departmentIDs))
+	for _, id := range departmentIDs {
+		if dp, ok := h.Departments[id]; ok {
+			granted = append(granted, dp)
+		}
+	}
+	sort.Slice(granted, func(i, j int) bool { return granted[i].Path < granted[j].Path })
+
+	roots := []*model.Department{}
+	for _, dp := range granted {
+		if n := len(roots); n > 0 && strings.HasPrefix(dp.Path, roots[n-1].Path+".") {
+			continue
+		}
+		roots = append(roots, dp)
+	}
+	return roots
+}
+
+// hierarchy returns all department trees and warns about orphans, which
+// are shown where their parent ids put them until paths are repaired, or
+// not shown at all if their parent ids form a cycle.
+func (d Department) hierarchy(ctx context.Context) (model.Hierarchy, error) {
+	h, err := d.rDptm.Hierarchy(ctx)
+	if err != nil {
+		return h, err
+	}
+	if len(h.Orphans) > 0 {
+		ids := make([]string, 0, len(h.Orphans))
+		for _, dp := range h.Orphans {
+			ids = append(ids, dp.ID)
+		}
+		d.log.Warnw("departments with inconsistent paths, run repair", "departments", ids)
+	}
+	return h, nil
+}
+
+// ExportDepartments passes every department caller may view to fn as it
+// is read.
+func (d Department) ExportDepartments(ctx context.Context, fn func(dto.DepartmentExportRow) error) error {
+	departmentIDs, all, err := d.authz.ViewScope(ctx)
+	if err != nil {
+		return err
+	}
+	if all {
+		departmentIDs = nil
+	}
+	return d.rDptm.Export(ctx, departmentIDs, fn)
+}
+
+// GetSubtree returns department with descendants down to requested depth.
+func (d Department) GetSubtree(ctx context.Context, req *dto.SubtreeDepartment) (*model.Department, error) {
+	if err := d.authz.Require(ctx, dto.RoleViewer, req.ID); err != nil {
+		return nil, err
+	}
+	dp, err := d.rDptm.GetByID(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	return d.rDptm.Subtree(ctx, dp, req.Depth)
+}
+
+// GetAncestors returns breadcrumbs of department from root to department itself.
+func (d Department) GetAncestors(ctx context.Context, departmentID string) ([]dto.DepartmentRef, error) {
+	if err := d.authz.Require(ctx, dto.RoleViewer, departmentID); err != nil {
+		return []dto.DepartmentRef{}, err
+	}
+	dp, err := d.rDptm.GetByID(ctx, departmentID)
+	if err != nil {
+		return []dto.DepartmentRef{}, err
+	}
+	ancestors, err := d.rDptm.Ancestors(ctx, dp)
+	if err != nil {
+		return []dto.DepartmentRef{}, err
+	}
+	refs := make([]dto.DepartmentRef, 0, len(ancestors))
+	for _, a := range ancestors {
+		refs = append(refs, dto.DepartmentRef{ID: a.ID, Name: a.Name})
+	}
+	return refs, nil
+}
+
+// OrgChart returns department trees with member counts, only the subtree
+// of root department if it is set or subtrees caller may view otherwise.
+func (d Department) OrgChart(ctx context.Context, req *dto.OrgChart) ([]*dto.OrgNode, error) {
+	var departmentIDs []string
+	all := false
+	if req.RootID != "" {
+		if err := d.authz.Require(ctx, dto.RoleViewer, req.RootID); err != nil {
+			return []*dto.OrgNode{}, err
+		}
+	} else {
+		var err error
+		if departmentIDs, all, err = d.authz.ViewScope(ctx); err != nil {
+			return []*dto.OrgNode{}, err
+		}
+	}
+	h, err := d.hierarchy(ctx)
+	if err != nil {
+		return []*dto.OrgNode{}, err
+	}
+	roots := h.Roots
+	switch {
+	case req.RootID != "":
+		root, ok := h.Departments[req.RootID]
+		if !ok {
+			return []*dto.OrgNode{}, apperror.NotFound("department not found", nil)
+		}
+		roots = []*model.Department{root}
+	case !all:
+		roots = visibleRoots(h, departmentIDs)
+	}
+	// nil paths count and list members of all departments
+	var subtreePaths []string
+	if req.RootID != "" || !all {
+		subtreePaths = make([]string, 0, len(roots))
+		for _, root := range roots {
+			subtreePaths = append(subtreePaths, root.Path)
 		}
 	}
-	return dps, nil
+
+	counts, err := d.rDptm.MemberCounts(ctx, subtreePaths)
+	if err != nil {
+		return []*dto.OrgNode{}, err
+	}
+	var members map[string][]model.Employee
+	if req.WithEmployees {
+		if members, err = d.rEmpl.Members(ctx, subtreePaths); err != nil {
+			return []*dto.OrgNode{}, err
+		}
+	}
+
+	var build func(dp *model.Department) *dto.OrgNode
+	build = func(dp *model.Department) *dto.OrgNode {
+		node := &dto.OrgNode{ID: dp.ID, Kind: dto.OrgNodeDepartment, Name: dp.Name,
+			Members: counts[dp.ID], Children: []*dto.OrgNode{}}
+		for _, e := range members[dp.ID] {
+			node.Children = append(node.Children, &dto.OrgNode{ID: e.ID, Kind: dto.OrgNodeEmployee,
+				Name: e.Name + " " + e.Surname, Children: []*dto.OrgNode{}})
+		}
+		for _, child := range sortedByName(dp.Children) {
+			node.Children = append(node.Children, build(child))
+		}
+		return node
+	}
+	nodes := make([]*dto.OrgNode, 0, len(roots))
+	for _, root := range sortedByName(roots) {
+		nodes = append(nodes, build(root))
+	}
+	return nodes, nil
 }
 
-func (d Department) GetAllDepartments(ctx context.Context) ([]dto.ViewAllDepartments, error) {
-	return d.rDptm.GetAll(ctx)
+// sortedByName returns departments ordered by name, so charts are stable.
+func sortedByName(dps []*model.Department) []*model.Department {
+	sorted := append([]*model.Department{}, dps...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
 }
 
-func (d Department) DeleteDepartment(ctx context.Context, dto *dto.DeleteDepartment) error {
-	return d.rDptm.Delete(ctx, dto)
+// GetAllDepartments lists departments of subtrees caller may view.
+func (d Department) GetAllDepartments(ctx context.Context, f *dto.ListDepartments) ([]dto.ViewAllDepartments, int, error) {
+	departmentIDs, all, err := d.authz.ViewScope(ctx)
+	if err != nil {
+		return []dto.ViewAllDepartments{}, 0, err
+	}
+	if all {
+		departmentIDs = nil
+	}
+	return d.rDptm.GetAll(ctx, f, departmentIDs)
+}
+
+// DeleteDepartment needs admin role on department, editor role on target
+// of reassigned members and on parent that gets reparented children.
+func (d Department) DeleteDepartment(ctx context.Context, req *dto.DeleteDepartment) (dto.DeleteDepartmentResult, error) {
+	res := dto.DeleteDepartmentResult{DryRun: req.DryRun, Strategy: req.Strategy}
+	if err := d.authz.Require(ctx, dto.RoleAdmin, req.ID); err != nil {
+		return res, err
+	}
+	switch req.Strategy {
+	case dto.DeleteStrategyReassign:
+		if err := d.authz.Require(ctx, dto.RoleEditor, req.TargetID); err != nil {
+			return res, err
+		}
+	case dto.DeleteStrategyReparent:
+		dp, err := d.rDptm.GetByID(ctx, req.ID)
+		if err != nil {
+			return res, err
+		}
+		ancestors, err := d.rDptm.Ancestors(ctx, dp)
+		if err != nil {
+			return res, err
+		}
+		parentID := ""
+		if n := len(ancestors); n > 1 {
+			parentID = ancestors[n-2].ID
+		}
+		if err := d.authz.requireParent(ctx, parentID); err != nil {
+			return res, err
+		}
+	}
+	return d.rDptm.Delete(ctx, req)
 }
 
-func (d Department) GetEmployeesByDepartment(ctx context.Context, departmentID string) ([]model.Employee, error) {
-	return d.rEmpl.GetByDepartment(ctx, departmentID)
+func (d Department) GetEmployeesByDepartment(ctx context.Context, departmentID string, f *dto.ListEmployees) ([]model.Employee, int, error) {
+	if err := d.authz.Require(ctx, dto.RoleViewer, departmentID); err != nil {
+		return []model.Employee{}, 0, err
+	}
+	return d.rEmpl.GetByDepartment(ctx, departmentID, f)
 }
 
-func (d Department) GetEmployeesInDepartmentHierarchy(ctx context.Context, departmentID string) ([]model.Employee, error) {
+func (d Department) GetEmployeesInDepartmentHierarchy(ctx context.Context, departmentID string, f *dto.ListEmployees) ([]model.Employee, int, error) {
+	if err := d.authz.Require(ctx, dto.RoleViewer, departmentID); err != nil {
+		return []model.Employee{}, 0, err
+	}
 	dp, err := d.rDptm.GetByID(ctx, departmentID)
 	if err != nil {
-		return []model.Employee{}, err
+		return []model.Employee{}, 0, err
 	}
-	return d.rEmpl.GetInDepartmentHierarchy(ctx, dp)
+	return d.rEmpl.GetInDepartmentHierarchy(ctx, dp, f)
 }
@@ -2,11 +2,16 @@ package usecase
 
 import (
 	"context"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
 	"github.com/dimashiro/test_mediasoft/internal/model"
 	"github.com/dimashiro/test_mediasoft/internal/model/dto"
 	"github.com/dimashiro/test_mediasoft/internal/repository/department"
 	"github.com/dimashiro/test_mediasoft/internal/repository/employee"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
@@ -14,28 +19,371 @@ type Employee struct {
 	log   *zap.SugaredLogger
 	rEmpl employee.EmployeeRepo
 	rDptm department.DepartmentRepo
+	authz *Authorizer
 }
 
-func NewEmployee(log *zap.SugaredLogger, rEmpl employee.EmployeeRepo, rDptm department.DepartmentRepo) *Employee {
-	return &Employee{log: log, rEmpl: rEmpl, rDptm: rDptm}
+func NewEmployee(log *zap.SugaredLogger, rEmpl employee.EmployeeRepo, rDptm department.DepartmentRepo,
+	authz *Authorizer) *Employee {
+	return &Employee{log: log, rEmpl: rEmpl, rDptm: rDptm, authz: authz}
 }
 
-func (e Employee) CreateEmployee(ctx context.Context, dto *dto.CreateEmployee) (model.Employee, error) {
-	empl, err := e.rEmpl.Create(ctx, dto)
+// CreateEmployee needs editor role on every department of employee.
+func (e Employee) CreateEmployee(ctx context.Context, req *dto.CreateEmployee) (model.Employee, error) {
+	if req.Memberships != nil {
+		req.Departments = dto.MembershipDepartments(req.Memberships)
+	}
+	if err := e.authz.Require(ctx, dto.RoleEditor, req.Departments...); err != nil {
+		return model.Employee{}, err
+	}
+	empl, err := e.rEmpl.Create(ctx, req)
 	if err != nil {
 		return model.Employee{}, err
 	}
 	return empl, nil
 }
 
-func (e Employee) GetAllEmployees(ctx context.Context) ([]model.Employee, error) {
-	return e.rEmpl.GetAll(ctx)
+// ImportEmployees resolves departments of rows by ids or full paths of
+// names and creates all employees in one transaction. Nothing is created if
+// any row is invalid, errors of all rows are returned as validation details.
+func (e Employee) ImportEmployees(ctx context.Context, req *dto.ImportEmployees) (dto.ImportEmployeesResult, error) {
+	res := dto.ImportEmployeesResult{DryRun: req.DryRun, Employees: []model.Employee{}}
+	if err := e.authz.RequireSomewhere(ctx, dto.RoleEditor); err != nil {
+		return res, err
+	}
+	h, err := e.rDptm.Hierarchy(ctx)
+	if err != nil {
+		return res, err
+	}
+	m := h.Departments
+	paths := departmentNamePaths(h.Roots)
+
+	rowErrors := []dto.ImportRowError{}
+	employees := make([]dto.CreateEmployee, 0, len(req.Rows))
+	for _, row := range req.Rows {
+		// birth year is checked by validation
+		year, _ := strconv.Atoi(row.BirthYear)
+		empl := dto.CreateEmployee{
+			Name:        strings.TrimSpace(row.Name),
+			Surname:     strings.TrimSpace(row.Surname),
+			BirthYear:   year,
+			Departments: []string{},
+		}
+		seen := make(map[string]bool, len(row.Departments))
+		for _, ref := range row.Departments {
+			id, msg := resolveDepartment(m, paths, ref)
+			if msg == "" && seen[id] {
+				msg = "department " + ref + " is listed twice"
+			}
+			if msg != "" {
+				rowErrors = append(rowErrors, dto.ImportRowError{Line: row.Line, Field: "departments", Message: msg})
+				continue
+			}
+			seen[id] = true
+			empl.Departments = append(empl.Departments, id)
+		}
+		employees = append(employees, empl)
+	}
+	if len(rowErrors) > 0 {
+		return res, apperror.Validation("import validation failed", rowErrors)
+	}
+	if err := e.authz.Require(ctx, dto.RoleEditor, departmentsOf(employees)...); err != nil {
+		return res, err
+	}
+
+	created, errs, err := e.rEmpl.Import(ctx, employees, req.DryRun)
+	if err != nil {
+		return res, err
+	}
+	for i, err := range errs {
+		rowErrors = append(rowErrors, dto.ImportRowError{Line: req.Rows[i].Line, Message: apperror.MessageOf(err)})
+	}
+	if len(rowErrors) > 0 {
+		sort.Slice(rowErrors, func(i, j int) bool { return rowErrors[i].Line < rowErrors[j].Line })
+		return res, apperror.Validation("import failed", rowErrors)
+	}
+
+	res.Created = len(created)
+	res.Employees = created
+	return res, nil
+}
+
+// departmentsOf returns distinct departments of employees.
+func departmentsOf(employees []dto.CreateEmployee) []string {
+	ids := []string{}
+	seen := make(map[string]bool)
+	for _, empl := range employees {
+		for _, id := range empl.Departments {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// departmentNamePaths maps normalized full paths of department names to
+// ids, several ids mean that path is ambiguous.
+func departmentNamePaths(roots []*model.Department) map[string][]string {
+	paths := make(map[string][]string)
+	var walk func(dp *model.Department, prefix string)
+	walk = func(dp *model.Department, prefix string) {
+		p := prefix + strings.ToLower(strings.TrimSpace(dp.Name))
+		paths[p] = append(paths[p], dp.ID)
+		for _, child := range dp.Children {
+			walk(child, p+" / ")
+		}
+	}
+	for _, dp := range roots {
+		walk(dp, "")
+	}
+	return paths
+}
+
+// resolveDepartment returns id of department given by id or by path like
+// "Software / Web", otherwise message of the problem.
+func resolveDepartment(m map[string]*model.Department, paths map[string][]string, ref string) (string, string) {
+	ref = strings.TrimSpace(ref)
+	if u, err := uuid.Parse(ref); err == nil {
+		if _, ok := m[u.String()]; !ok {
+			return "", "department " + ref + " not found"
+		}
+		return u.String(), ""
+	}
+	parts := strings.Split(ref, "/")
+	for i := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(parts[i]))
+	}
+	ids := paths[strings.Join(parts, " / ")]
+	switch len(ids) {
+	case 0:
+		return "", "department " + ref + " not found"
+	case 1:
+		return ids[0], ""
+	default:
+		return "", "department path " + ref + " is ambiguous, use id"
+	}
+}
+
+// ExportEmployees passes every employee caller may view to fn as it is
+// read, that is members of subtrees where caller has a role.
+func (e Employee) ExportEmployees(ctx context.Context, fn func(dto.EmployeeExportRow) error) error {
+	departmentIDs, all, err := e.authz.ViewScope(ctx)
+	if err != nil {
+		return err
+	}
+	if all {
+		departmentIDs = nil
+	}
+	return e.rEmpl.Export(ctx, departmentIDs, fn)
+}
+
+func (e Employee) GetEmployee(ctx context.Context, employeeID string) (dto.ViewEmployee, error) {
+	empl, err := e.rEmpl.GetByID(ctx, employeeID)
+	if err != nil {
+		return dto.ViewEmployee{}, err
+	}
+	dps, err := e.rEmpl.GetDepartments(ctx, empl.ID)
+	if err != nil {
+		return dto.ViewEmployee{}, err
+	}
+	ids := make([]string, 0, len(dps))
+	for _, dp := range dps {
+		ids = append(ids, dp.ID)
+	}
+	if err := e.authz.RequireOneOf(ctx, dto.RoleViewer, ids); err != nil {
+		return dto.ViewEmployee{}, err
+	}
+	manager, err := employeeRef(ctx, e.rEmpl, empl.ManagerID)
+	if err != nil {
+		return dto.ViewEmployee{}, err
+	}
+	return dto.ViewEmployee{
+		ID:          empl.ID,
+		Name:        empl.Name,
+		Surname:     empl.Surname,
+		BirthYear:   empl.BirthYear,
+		Manager:     manager,
+		Departments: dps,
+		Version:     empl.Version,
+	}, nil
+}
+
+// employeeRef returns reference to employee with employeeID, nil if it is nil.
+func employeeRef(ctx context.Context, rEmpl employee.EmployeeRepo, employeeID *string) (*dto.EmployeeRef, error) {
+	if employeeID == nil {
+		return nil, nil
+	}
+	empl, err := rEmpl.GetByID(ctx, *employeeID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.EmployeeRef{ID: empl.ID, Name: empl.Name, Surname: empl.Surname}, nil
+}
+
+// GetAllEmployees lists only employees of subtrees where caller has a role.
+func (e Employee) GetAllEmployees(ctx context.Context, f *dto.ListEmployees) ([]model.Employee, int, error) {
+	departmentIDs, all, err := e.authz.ViewScope(ctx)
+	if err != nil {
+		return []model.Employee{}, 0, err
+	}
+	if all {
+		departmentIDs = nil
+	}
+	return e.rEmpl.GetAll(ctx, f, departmentIDs)
+}
+
+func (e Employee) SearchEmployees(ctx context.Context, f *dto.SearchEmployees) ([]dto.EmployeeSearchResult, error) {
+	if f.Limit == 0 {
+		f.Limit = dto.DefaultSearchLimit
+	}
+	subtreePath := ""
+	// search within department needs no scope, the whole subtree is visible
+	var departmentIDs []string
+	if f.DepartmentID == "" {
+		ids, all, err := e.authz.ViewScope(ctx)
+		if err != nil {
+			return []dto.EmployeeSearchResult{}, err
+		}
+		if !all {
+			departmentIDs = ids
+		}
+	} else {
+		if err := e.authz.Require(ctx, dto.RoleViewer, f.DepartmentID); err != nil {
+			return []dto.EmployeeSearchResult{}, err
+		}
+		dp, err := e.rDptm.GetByID(ctx, f.DepartmentID)
+		if err != nil {
+			return []dto.EmployeeSearchResult{}, err
+		}
+		subtreePath = dp.Path
+	}
+	return e.rEmpl.Search(ctx, f, subtreePath, departmentIDs)
+}
+
+// GetEmployeeTimeline returns current and closed memberships of employee.
+func (e Employee) GetEmployeeTimeline(ctx context.Context, employeeID string) ([]dto.MembershipPeriod, error) {
+	if err := e.authorizeView(ctx, employeeID); err != nil {
+		return []dto.MembershipPeriod{}, err
+	}
+	return e.rEmpl.Timeline(ctx, employeeID)
+}
+
+// GetManagers returns chain of managers of employee from the direct one up,
+// so manager of manager is the second one.
+func (e Employee) GetManagers(ctx context.Context, employeeID string) ([]dto.EmployeeRef, error) {
+	if err := e.authorizeView(ctx, employeeID); err != nil {
+		return []dto.EmployeeRef{}, err
+	}
+	return e.rEmpl.Managers(ctx, employeeID)
+}
+
+// GetReports returns employees reporting directly to employee.
+func (e Employee) GetReports(ctx context.Context, employeeID string) ([]dto.EmployeeRef, error) {
+	if err := e.authorizeView(ctx, employeeID); err != nil {
+		return []dto.EmployeeRef{}, err
+	}
+	return e.rEmpl.Reports(ctx, employeeID)
+}
+
+// GetReportingTree returns employee with everyone reporting to it directly
+// or through other managers.
+func (e Employee) GetReportingTree(ctx context.Context, req *dto.ReportingTree) (*dto.ReportingNode, error) {
+	if err := e.authorizeView(ctx, req.ID); err != nil {
+		return nil, err
+	}
+	return e.rEmpl.ReportingTree(ctx, req.ID, req.Depth)
+}
+
+// authorizeView needs viewer role on one of current departments of employee.
+func (e Employee) authorizeView(ctx context.Context, employeeID string) error {
+	if _, err := e.rEmpl.GetByID(ctx, employeeID); err != nil {
+		return err
+	}
+	current, err := e.currentDepartments(ctx, employeeID)
+	if err != nil {
+		return err
+	}
+	return e.authz.RequireOneOf(ctx, dto.RoleViewer, current)
+}
+
+func (e Employee) UpdateEmployee(ctx context.Context, req *dto.UpdateEmployee) error {
+	if req.Memberships != nil {
+		req.Departments = dto.MembershipDepartments(req.Memberships)
+		// positions may change in every listed department
+		if err := e.authz.Require(ctx, dto.RoleEditor, req.Departments...); err != nil {
+			return err
+		}
+	}
+	changesFields := req.Name != nil || req.Surname != nil || req.BirthYear != nil || req.ManagerID != nil
+	if err := e.authorizeUpdate(ctx, req.ID, req.Departments, changesFields); err != nil {
+		return err
+	}
+	return e.rEmpl.Update(ctx, req)
 }
 
-func (e Employee) UpdateEmployee(ctx context.Context, dto *dto.UpdateEmployee) error {
-	return e.rEmpl.Update(ctx, dto)
+// DeleteEmployee needs editor role on every department of employee.
+func (e Employee) DeleteEmployee(ctx context.Context, req *dto.DeleteEmployee) error {
+	current, err := e.currentDepartments(ctx, req.ID)
+	if err != nil {
+		return err
+	}
+	if err := e.authz.Require(ctx, dto.RoleEditor, current...); err != nil {
+		return err
+	}
+	return e.rEmpl.Delete(ctx, req)
 }
 
-func (e Employee) DeleteEmployee(ctx context.Context, dto *dto.DeleteEmployee) error {
-	return e.rEmpl.Delete(ctx, dto)
+// authorizeUpdate needs editor role on one of current departments of
+// employee to change its fields and on every department that employee
+// leaves or joins to change its departments, nil departments are kept.
+func (e Employee) authorizeUpdate(ctx context.Context, employeeID string, departments []string, changesFields bool) error {
+	current, err := e.currentDepartments(ctx, employeeID)
+	if err != nil {
+		return err
+	}
+	changed := []string{}
+	if departments != nil {
+		now := make(map[string]bool, len(current))
+		for _, id := range current {
+			now[id] = true
+		}
+		next := make(map[string]bool, len(departments))
+		for _, id := range departments {
+			next[id] = true
+			if !now[id] {
+				changed = append(changed, id)
+			}
+		}
+		for _, id := range current {
+			if !next[id] {
+				changed = append(changed, id)
+			}
+		}
+	}
+	if changesFields || len(changed) == 0 {
+		if err := e.authz.RequireOneOf(ctx, dto.RoleEditor, current); err != nil {
+			return err
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return e.authz.Require(ctx, dto.RoleEditor, changed...)
+}
+
+// currentDepartments returns ids of departments employee belongs to now.
+func (e Employee) currentDepartments(ctx context.Context, employeeID string) ([]string, error) {
+	if _, err := uuid.Parse(employeeID); err != nil {
+		return []string{}, apperror.BadRequest("wrong employee id", err)
+	}
+	dps, err := e.rEmpl.GetDepartments(ctx, employeeID)
+	if err != nil {
+		return []string{}, err
+	}
+	ids := make([]string, 0, len(dps))
+	for _, dp := range dps {
+		ids = append(ids, dp.ID)
+	}
+	return ids, nil
 }
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/outbox"
+	"go.uber.org/zap"
+)
+
+const (
+	// events kept for a subscriber that doesn't read them
+	subscriberBuffer = 64
+	// events sent on resume by Last-Event-ID
+	maxReplay = 1000
+	// pause before listening again after connection failure
+	relistenDelay = time.Second
+)
+
+// Events broadcasts committed outbox events to stream subscribers.
+type Events struct {
+	log     *zap.SugaredLogger
+	rOutbox outbox.OutboxRepo
+
+	mu   sync.Mutex
+	subs map[chan dto.Event]struct{}
+}
+
+func NewEvents(log *zap.SugaredLogger, rOutbox outbox.OutboxRepo) *Events {
+	return &Events{log: log, rOutbox: rOutbox, subs: make(map[chan dto.Event]struct{})}
+}
+
+// Subscribe returns channel of events committed from now on and function
+// that cancels subscription. The channel is closed if subscriber falls
+// behind, it should resume from the last received event then. Events of all
+// departments are for admins only.
+func (e *Events) Subscribe(ctx context.Context) (<-chan dto.Event, func(), error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan dto.Event, subscriberBuffer)
+	e.mu.Lock()
+	e.subs[ch] = struct{}{}
+	e.mu.Unlock()
+
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subs[ch]; ok {
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}, nil
+}
+
+// Replay returns events following eventID, at most maxReplay of them,
+// true means that there are more events to replay.
+func (e *Events) Replay(ctx context.Context, eventID int64) ([]dto.Event, bool, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return []dto.Event{}, false, err
+	}
+	events, err := e.rOutbox.After(ctx, eventID, maxReplay+1)
+	if err != nil {
+		return events, false, err
+	}
+	if len(events) > maxReplay {
+		return events[:maxReplay], true, nil
+	}
+	return events, false, nil
+}
+
+// Run listens for committed events and broadcasts them until ctx is done.
+func (e *Events) Run(ctx context.Context) {
+	e.log.Infow("start", "status", "start event listener")
+	defer e.log.Infow("shutdown", "status", "event listener stopped")
+
+	for {
+		err := e.rOutbox.Listen(ctx, func(eventID int64) {
+			ev, err := e.rOutbox.GetByID(ctx, eventID)
+			if err != nil {
+				e.log.Errorw("events", "ERROR", err)
+				return
+			}
+			e.broadcast(ev)
+		})
+		// events committed before listening again would be lost, so
+		// subscribers are dropped to resume by their last event
+		e.dropAll()
+		if ctx.Err() != nil {
+			return
+		}
+		e.log.Errorw("events", "ERROR", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(relistenDelay):
+		}
+	}
+}
+
+func (e *Events) broadcast(ev dto.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+			// slow subscriber is dropped instead of blocking the others
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (e *Events) dropAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		delete(e.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,297 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/apperror"
+	"github.com/dimashiro/test_mediasoft/internal/identity"
+	"github.com/dimashiro/test_mediasoft/internal/model"
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/department"
+	"github.com/dimashiro/test_mediasoft/internal/repository/employee"
+	"github.com/dimashiro/test_mediasoft/internal/repository/schedule"
+	"go.uber.org/zap"
+)
+
+const (
+	// changeLease is time worker has to apply claimed change, after that
+	// the change is considered interrupted and is claimed again
+	changeLease = 5 * time.Minute
+	// change interrupted this many times is failed instead of being applied
+	maxChangeAttempts = 3
+	// finishTimeout bounds recording of result after ctx is cancelled
+	finishTimeout = 10 * time.Second
+)
+
+// Schedule keeps future-dated changes and applies them through department
+// and employee usecases when they are due.
+type Schedule struct {
+	log        *zap.SugaredLogger
+	rSchedule  schedule.ScheduleRepo
+	rDptm      department.DepartmentRepo
+	rEmpl      employee.EmployeeRepo
+	department *Department
+	employee   *Employee
+	authz      *Authorizer
+	auth       *Auth
+}
+
+func NewSchedule(log *zap.SugaredLogger, rSchedule schedule.ScheduleRepo, rDptm department.DepartmentRepo,
+	rEmpl employee.EmployeeRepo, department *Department, employee *Employee, authz *Authorizer, auth *Auth) *Schedule {
+	return &Schedule{log: log, rSchedule: rSchedule, rDptm: rDptm, rEmpl: rEmpl,
+		department: department, employee: employee, authz: authz, auth: auth}
+}
+
+// CreateChange schedules change after checking that its subject exists.
+// Caller needs the same roles as for making the change now, they are
+// checked once more when the change is applied.
+func (s Schedule) CreateChange(ctx context.Context, req *dto.CreateScheduledChange) (dto.ScheduledChange, error) {
+	switch req.Kind {
+	case dto.ChangeDepartmentMove, dto.ChangeDepartmentRename:
+		if _, err := s.rDptm.GetByID(ctx, req.DepartmentID); err != nil {
+			return dto.ScheduledChange{}, err
+		}
+	case dto.ChangeEmployeeTransfer:
+		if _, err := s.rEmpl.GetByID(ctx, req.EmployeeID); err != nil {
+			return dto.ScheduledChange{}, err
+		}
+	}
+	err := s.authorizeChange(ctx, dto.ScheduledChange{Kind: req.Kind, DepartmentID: req.DepartmentID,
+		ParentID: req.ParentID, EmployeeID: req.EmployeeID, Departments: req.Departments})
+	if err != nil {
+		return dto.ScheduledChange{}, err
+	}
+	return s.rSchedule.Create(ctx, req, identity.Actor(ctx))
+}
+
+// authorizeChange checks roles needed to make change c.
+func (s Schedule) authorizeChange(ctx context.Context, c dto.ScheduledChange) error {
+	switch c.Kind {
+	case dto.ChangeDepartmentMove:
+		return s.department.authorizeMove(ctx, c.DepartmentID, c.ParentID)
+	case dto.ChangeDepartmentRename:
+		return s.authz.Require(ctx, dto.RoleEditor, c.DepartmentID)
+	case dto.ChangeEmployeeTransfer:
+		return s.employee.authorizeUpdate(ctx, c.EmployeeID, c.Departments, false)
+	default:
+		return requireAdmin(ctx)
+	}
+}
+
+func (s Schedule) GetChange(ctx context.Context, changeID string) (dto.ScheduledChange, error) {
+	c, err := s.rSchedule.GetByID(ctx, changeID)
+	if err != nil {
+		return c, err
+	}
+	if err := s.authorizeView(ctx, c); err != nil {
+		return dto.ScheduledChange{}, err
+	}
+	return c, nil
+}
+
+// GetChanges lists changes touching subtrees caller may view.
+func (s Schedule) GetChanges(ctx context.Context, f *dto.ListScheduledChanges) ([]dto.ScheduledChange, int, error) {
+	departmentIDs, all, err := s.authz.ViewScope(ctx)
+	if err != nil {
+		return []dto.ScheduledChange{}, 0, err
+	}
+	if all {
+		departmentIDs = nil
+	}
+	return s.rSchedule.List(ctx, f, departmentIDs)
+}
+
+// authorizeView needs viewer role on one of departments change touches,
+// the same ones GetChanges filters by.
+func (s Schedule) authorizeView(ctx context.Context, c dto.ScheduledChange) error {
+	ids := []string{}
+	for _, id := range append([]string{c.DepartmentID, c.ParentID}, c.Departments...) {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if c.EmployeeID != "" {
+		dps, err := s.rEmpl.GetDepartments(ctx, c.EmployeeID)
+		if err != nil && apperror.CodeOf(err) != apperror.CodeNotFound {
+			return err
+		}
+		for _, dp := range dps {
+			ids = append(ids, dp.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return requireAdmin(ctx)
+	}
+	return s.authz.RequireOneOf(ctx, dto.RoleViewer, ids)
+}
+
+// CancelChange needs the roles that are needed to schedule the change.
+func (s Schedule) CancelChange(ctx context.Context, changeID string) (dto.ScheduledChange, error) {
+	c, err := s.rSchedule.GetByID(ctx, changeID)
+	if err != nil {
+		return c, err
+	}
+	if err := s.authorizeChange(ctx, c); err != nil {
+		return dto.ScheduledChange{}, err
+	}
+	return s.rSchedule.Cancel(ctx, changeID)
+}
+
+// PreviewChange describes subject of change as it is now and as it would be
+// after applying the change.
+func (s Schedule) PreviewChange(ctx context.Context, changeID string) (dto.ScheduledChangePreview, error) {
+	c, err := s.GetChange(ctx, changeID)
+	if err != nil {
+		return dto.ScheduledChangePreview{}, err
+	}
+	p := dto.ScheduledChangePreview{Change: c, Before: []string{}, After: []string{}}
+
+	switch c.Kind {
+	case dto.ChangeDepartmentMove, dto.ChangeDepartmentRename:
+		dp, err := s.rDptm.GetByID(ctx, c.DepartmentID)
+		if err != nil {
+			return p, err
+		}
+		if p.Subject, err = s.fullPath(ctx, dp); err != nil {
+			return p, err
+		}
+		if c.Kind == dto.ChangeDepartmentRename {
+			p.Before = append(p.Before, dp.Name)
+			p.After = append(p.After, c.Name)
+			break
+		}
+		p.Before = append(p.Before, p.Subject)
+		if c.ParentID == "" {
+			p.After = append(p.After, dp.Name)
+			break
+		}
+		parent, err := s.rDptm.GetByID(ctx, c.ParentID)
+		if err != nil {
+			p.Problem = apperror.MessageOf(apperror.Wrap(err, "new parent not found"))
+			break
+		}
+		if parent.Path == dp.Path || strings.HasPrefix(parent.Path, dp.Path+".") {
+			p.Problem = "cannot move department into itself or its descendant"
+		}
+		parentPath, err := s.fullPath(ctx, parent)
+		if err != nil {
+			return p, err
+		}
+		p.After = append(p.After, parentPath+" / "+dp.Name)
+	case dto.ChangeEmployeeTransfer:
+		empl, err := s.rEmpl.GetByID(ctx, c.EmployeeID)
+		if err != nil {
+			return p, err
+		}
+		p.Subject = empl.Name + " " + empl.Surname
+		dps, err := s.rEmpl.GetDepartments(ctx, empl.ID)
+		if err != nil {
+			return p, err
+		}
+		for _, dp := range dps {
+			p.Before = append(p.Before, dp.FullPath)
+		}
+		for _, id := range c.Departments {
+			dp, err := s.rDptm.GetByID(ctx, id)
+			if err != nil {
+				p.Problem = apperror.MessageOf(apperror.Wrap(err, "department "+id+" not found"))
+				continue
+			}
+			path, err := s.fullPath(ctx, dp)
+			if err != nil {
+				return p, err
+			}
+			p.After = append(p.After, path)
+		}
+	}
+	return p, nil
+}
+
+// fullPath joins names of department ancestors like "Software / Web / Backend".
+func (s Schedule) fullPath(ctx context.Context, dp model.Department) (string, error) {
+	ancestors, err := s.rDptm.Ancestors(ctx, dp)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(ancestors))
+	for _, a := range ancestors {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, " / "), nil
+}
+
+// ApplyDue applies all changes effective by now one by one, each in its own
+// transaction, and returns amount of successfully applied ones. A failed
+// change is marked as failed and doesn't stop the others.
+//
+// Change is claimed for changeLease. If the worker dies before recording
+// the result, the change is claimed again when the lease expires and applied
+// once more. Changes set a target state (parent, name, departments), so
+// applying a change that already took effect doesn't change anything.
+func (s Schedule) ApplyDue(ctx context.Context) (int, error) {
+	applied := 0
+	for {
+		c, ok, err := s.rSchedule.ClaimDue(ctx, time.Now(), changeLease)
+		if err != nil || !ok {
+			return applied, err
+		}
+
+		var applyErr error
+		if c.Attempts > maxChangeAttempts {
+			applyErr = apperror.Conflict("applying was interrupted too many times", nil)
+		} else {
+			applyErr = s.applyAsCreator(ctx, c)
+		}
+		// change interrupted by shutdown isn't failed, it is claimed again
+		// when its lease expires
+		if applyErr != nil && ctx.Err() != nil {
+			return applied, ctx.Err()
+		}
+		if applyErr != nil {
+			s.log.Warnw("scheduled change failed", "change", c.ID, "kind", c.Kind, "ERROR", applyErr)
+		} else {
+			applied++
+		}
+		if err := s.finish(c, applyErr); err != nil {
+			return applied, err
+		}
+		if ctx.Err() != nil {
+			return applied, ctx.Err()
+		}
+	}
+}
+
+// finish records result of change on its own context, so that result of
+// change applied just before shutdown isn't lost, but waits for database
+// no longer than finishTimeout.
+func (s Schedule) finish(c dto.ScheduledChange, applyErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+	return s.rSchedule.Finish(ctx, c, applyErr)
+}
+
+// applyAsCreator makes change on behalf of the one who scheduled it, with
+// roles they have now, so a change whose creator lost them fails.
+func (s Schedule) applyAsCreator(ctx context.Context, c dto.ScheduledChange) error {
+	creator, err := s.auth.Identify(ctx, c.CreatedBy)
+	if err != nil {
+		return err
+	}
+	return s.apply(identity.WithIdentity(ctx, creator), c)
+}
+
+func (s Schedule) apply(ctx context.Context, c dto.ScheduledChange) error {
+	switch c.Kind {
+	case dto.ChangeDepartmentMove:
+		return s.department.MoveDepartment(ctx, &dto.MoveDepartment{ID: c.DepartmentID, ParentID: c.ParentID})
+	case dto.ChangeDepartmentRename:
+		name := c.Name
+		return s.department.UpdateDepartment(ctx, &dto.UpdateDepartment{ID: c.DepartmentID, Name: &name})
+	case dto.ChangeEmployeeTransfer:
+		return s.employee.UpdateEmployee(ctx, &dto.UpdateEmployee{ID: c.EmployeeID, Departments: c.Departments})
+	default:
+		return apperror.BadRequest("unknown change kind: "+c.Kind, nil)
+	}
+}
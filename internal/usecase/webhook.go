@@ -0,0 +1,205 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"github.com/dimashiro/test_mediasoft/internal/repository/webhook"
+	"go.uber.org/zap"
+)
+
+// Headers of webhook requests. Signature is "sha256=" followed by hex of
+// HMAC-SHA256 of request body keyed by webhook secret.
+const (
+	HeaderEventID   = "X-Event-Id"
+	HeaderEventType = "X-Event-Type"
+	HeaderSignature = "X-Signature"
+)
+
+const (
+	// events fanned out and deliveries sent by one pass
+	dispatchBatch = 100
+	// after this many failed attempts delivery is dead
+	maxDeliveryAttempts = 8
+	firstRetryDelay     = 30 * time.Second
+	maxRetryDelay       = 6 * time.Hour
+	// stored part of error or response body
+	maxDeliveryError = 512
+)
+
+// Webhook keeps subscriptions to change events and delivers events written
+// to outbox by repositories.
+type Webhook struct {
+	log      *zap.SugaredLogger
+	rWebhook webhook.WebhookRepo
+	client   *http.Client
+}
+
+func NewWebhook(log *zap.SugaredLogger, rWebhook webhook.WebhookRepo, client *http.Client) *Webhook {
+	return &Webhook{log: log, rWebhook: rWebhook, client: client}
+}
+
+// CreateWebhook subscribes to events of all departments, so webhooks are
+// managed by admins only.
+func (wh Webhook) CreateWebhook(ctx context.Context, req *dto.CreateWebhook) (dto.Webhook, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return dto.Webhook{}, err
+	}
+	return wh.rWebhook.Create(ctx, req)
+}
+
+func (wh Webhook) GetWebhooks(ctx context.Context) ([]dto.Webhook, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return []dto.Webhook{}, err
+	}
+	return wh.rWebhook.List(ctx)
+}
+
+func (wh Webhook) DeleteWebhook(ctx context.Context, webhookID string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	return wh.rWebhook.Delete(ctx, webhookID)
+}
+
+// GetDeliveries returns deliveries newest first, dead ones are the dead
+// letter queue.
+func (wh Webhook) GetDeliveries(ctx context.Context, f *dto.ListDeliveries) ([]dto.WebhookDelivery, int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return []dto.WebhookDelivery{}, 0, err
+	}
+	return wh.rWebhook.ListDeliveries(ctx, f)
+}
+
+// Dispatch turns new outbox events into deliveries and sends all due ones,
+// returns amount of delivered events.
+func (wh Webhook) Dispatch(ctx context.Context) (int, error) {
+	for {
+		n, err := wh.rWebhook.FanOut(ctx, dispatchBatch)
+		if err != nil {
+			return 0, err
+		}
+		if n < dispatchBatch {
+			break
+		}
+	}
+
+	delivered := 0
+	for ctx.Err() == nil {
+		// lease outlives all attempts of the batch, so nothing is sent twice
+		timeout := wh.client.Timeout
+		if timeout == 0 {
+			timeout = time.Minute
+		}
+		lease := time.Duration(dispatchBatch+1) * timeout
+		deliveries, err := wh.rWebhook.ClaimDeliveries(ctx, dispatchBatch, lease)
+		if err != nil {
+			return delivered, err
+		}
+		for _, d := range deliveries {
+			ok, err := wh.deliver(ctx, d)
+			if err != nil {
+				return delivered, err
+			}
+			if ok {
+				delivered++
+			}
+		}
+		if len(deliveries) < dispatchBatch {
+			break
+		}
+	}
+	return delivered, ctx.Err()
+}
+
+// deliver sends event once and records result, false means the attempt
+// failed and is going to be retried or the delivery is dead.
+func (wh Webhook) deliver(ctx context.Context, d dto.PendingDelivery) (bool, error) {
+	status, sendErr := wh.send(ctx, d)
+	// result is recorded even if ctx was cancelled during the request
+	if sendErr == nil {
+		return true, wh.rWebhook.MarkDelivered(context.Background(), d, status)
+	}
+	// interrupted attempt isn't counted, the delivery is sent again when
+	// its lease expires
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	attempts := d.Attempts + 1
+	dead := attempts >= maxDeliveryAttempts
+	if dead {
+		wh.log.Warnw("webhook delivery is dead", "webhook", d.WebhookID, "event", d.Event.ID, "ERROR", sendErr)
+	}
+	err := wh.rWebhook.MarkFailed(context.Background(), d, status, truncate(sendErr.Error(), maxDeliveryError),
+		time.Now().Add(retryDelay(attempts)), dead)
+	return false, err
+}
+
+// send posts signed event, any response other than 2xx is an error.
+func (wh Webhook) send(ctx context.Context, d dto.PendingDelivery) (int, error) {
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		return 0, fmt.Errorf("can't marshal event: %s", err.Error())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("can't create request: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, strconv.FormatInt(d.Event.ID, 10))
+	req.Header.Set(HeaderEventType, d.Event.Type)
+	req.Header.Set(HeaderSignature, Sign(d.Secret, body))
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxDeliveryError))
+		return resp.StatusCode, fmt.Errorf("unexpected status %s: %s", resp.Status, msg)
+	}
+	// drained body lets the connection be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	return resp.StatusCode, nil
+}
+
+// Sign returns value of signature header for body, receivers compute the
+// same with their copy of secret and compare.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay doubles delay after each failed attempt.
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,285 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dimashiro/test_mediasoft/internal/model/dto"
+	"go.uber.org/zap"
+)
+
+// fakeDelivery is state of delivery kept by fakeWebhookRepo.
+type fakeDelivery struct {
+	d          dto.PendingDelivery
+	status     string
+	lastStatus int
+	next       time.Time
+	// delays between attempts and the moment they were scheduled
+	delays []time.Duration
+}
+
+// fakeWebhookRepo keeps deliveries in memory and lets every pending one be
+// claimed at once, as if time of the next attempt has come.
+type fakeWebhookRepo struct {
+	mu         sync.Mutex
+	deliveries []*fakeDelivery
+}
+
+func (r *fakeWebhookRepo) Create(ctx context.Context, req *dto.CreateWebhook) (dto.Webhook, error) {
+	return dto.Webhook{}, nil
+}
+
+func (r *fakeWebhookRepo) List(ctx context.Context) ([]dto.Webhook, error) {
+	return []dto.Webhook{}, nil
+}
+
+func (r *fakeWebhookRepo) Delete(ctx context.Context, webhookID string) error {
+	return nil
+}
+
+func (r *fakeWebhookRepo) ListDeliveries(ctx context.Context, f *dto.ListDeliveries) ([]dto.WebhookDelivery, int, error) {
+	return []dto.WebhookDelivery{}, 0, nil
+}
+
+func (r *fakeWebhookRepo) FanOut(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+func (r *fakeWebhookRepo) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]dto.PendingDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	claimed := []dto.PendingDelivery{}
+	for _, fd := range r.deliveries {
+		if fd.status == dto.DeliveryPending && len(claimed) < limit {
+			claimed = append(claimed, fd.d)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *fakeWebhookRepo) find(d dto.PendingDelivery) *fakeDelivery {
+	for _, fd := range r.deliveries {
+		if fd.d.WebhookID == d.WebhookID && fd.d.Event.ID == d.Event.ID {
+			return fd
+		}
+	}
+	panic("unknown delivery")
+}
+
+func (r *fakeWebhookRepo) MarkDelivered(ctx context.Context, d dto.PendingDelivery, status int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fd := r.find(d)
+	fd.status, fd.lastStatus = dto.DeliveryDelivered, status
+	fd.d.Attempts++
+	return nil
+}
+
+func (r *fakeWebhookRepo) MarkFailed(ctx context.Context, d dto.PendingDelivery, status int, msg string,
+	next time.Time, dead bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fd := r.find(d)
+	fd.lastStatus, fd.next = status, next
+	fd.delays = append(fd.delays, time.Until(next))
+	fd.d.Attempts++
+	if dead {
+		fd.status = dto.DeliveryDead
+	}
+	return nil
+}
+
+// request is what receiver got.
+type request struct {
+	body   []byte
+	header http.Header
+}
+
+// receiver is local webhook endpoint answering with statuses in turn, the
+// last one is repeated.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []request
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, request{body: body, header: r.Header.Clone()})
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+const testSecret = "0123456789abcdef"
+
+func newWebhookTest(t *testing.T, statuses ...int) (*Webhook, *fakeWebhookRepo, *receiver) {
+	t.Helper()
+	rc := &receiver{statuses: statuses}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	repo := &fakeWebhookRepo{deliveries: []*fakeDelivery{{
+		status: dto.DeliveryPending,
+		d: dto.PendingDelivery{
+			WebhookID: "5b1f5d8e-7a5f-4f3e-9d37-0d7c7f1a2b3c",
+			URL:       srv.URL,
+			Secret:    testSecret,
+			Event: dto.Event{
+				ID:        42,
+				Type:      dto.EventEmployeeCreated,
+				EntityID:  "9c4b2a7e-1d3f-4e5a-8b6c-7d8e9f0a1b2c",
+				CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+				Data:      json.RawMessage(`{"Name":"Ivan"}`),
+			},
+		},
+	}}}
+	wh := NewWebhook(zap.NewNop().Sugar(), repo, srv.Client())
+	return wh, repo, rc
+}
+
+func TestDispatchSignsAndDelivers(t *testing.T) {
+	wh, repo, rc := newWebhookTest(t, http.StatusNoContent)
+
+	n, err := wh.Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("delivered = %d, want 1", n)
+	}
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(rc.requests))
+	}
+	req := rc.requests[0]
+	if got, want := req.header.Get(HeaderSignature), Sign(testSecret, req.body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := req.header.Get(HeaderEventID); got != "42" {
+		t.Errorf("event id header = %q, want 42", got)
+	}
+	if got := req.header.Get(HeaderEventType); got != dto.EventEmployeeCreated {
+		t.Errorf("event type header = %q, want %s", got, dto.EventEmployeeCreated)
+	}
+	var ev dto.Event
+	if err := json.Unmarshal(req.body, &ev); err != nil {
+		t.Fatalf("body is not an event: %v", err)
+	}
+	if ev.ID != 42 || ev.EntityID != repo.deliveries[0].d.Event.EntityID {
+		t.Errorf("body = %+v", ev)
+	}
+
+	fd := repo.deliveries[0]
+	if fd.status != dto.DeliveryDelivered || fd.lastStatus != http.StatusNoContent {
+		t.Errorf("delivery status = %s %d, want delivered 204", fd.status, fd.lastStatus)
+	}
+}
+
+func TestSignDependsOnSecretAndBody(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	sig := Sign(testSecret, body)
+	if len(sig) != len("sha256=")+64 || sig[:7] != "sha256=" {
+		t.Fatalf("signature format: %q", sig)
+	}
+	if Sign(testSecret, body) != sig {
+		t.Error("signature is not deterministic")
+	}
+	if Sign(testSecret+"x", body) == sig {
+		t.Error("signature doesn't depend on secret")
+	}
+	if Sign(testSecret, []byte(`{"id":2}`)) == sig {
+		t.Error("signature doesn't depend on body")
+	}
+}
+
+func TestDispatchRetriesServerErrorsWithBackoff(t *testing.T) {
+	wh, repo, rc := newWebhookTest(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+
+	for i := 0; i < 2; i++ {
+		n, err := wh.Dispatch(context.Background())
+		if err != nil {
+			t.Fatalf("Dispatch %d: %v", i, err)
+		}
+		if n != 0 {
+			t.Fatalf("Dispatch %d delivered %d, want 0", i, n)
+		}
+		fd := repo.deliveries[0]
+		if fd.status != dto.DeliveryPending {
+			t.Fatalf("status after failure %d = %s, want pending", i, fd.status)
+		}
+	}
+	fd := repo.deliveries[0]
+	if fd.lastStatus != http.StatusBadGateway {
+		t.Errorf("last status = %d, want 502", fd.lastStatus)
+	}
+	for i, want := range []time.Duration{firstRetryDelay, 2 * firstRetryDelay} {
+		if got := fd.delays[i]; got > want || got < want-5*time.Second {
+			t.Errorf("delay after attempt %d = %s, want %s", i+1, got, want)
+		}
+	}
+
+	n, err := wh.Dispatch(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("third Dispatch = %d, %v, want 1 delivered", n, err)
+	}
+	if fd.status != dto.DeliveryDelivered || fd.d.Attempts != 3 {
+		t.Errorf("delivery = %s after %d attempts, want delivered after 3", fd.status, fd.d.Attempts)
+	}
+	if len(rc.requests) != 3 {
+		t.Errorf("requests = %d, want 3", len(rc.requests))
+	}
+}
+
+func TestDispatchMovesToDeadLetterAfterMaxAttempts(t *testing.T) {
+	wh, repo, rc := newWebhookTest(t, http.StatusServiceUnavailable)
+
+	for i := 0; i < maxDeliveryAttempts+2; i++ {
+		if _, err := wh.Dispatch(context.Background()); err != nil {
+			t.Fatalf("Dispatch %d: %v", i, err)
+		}
+	}
+	fd := repo.deliveries[0]
+	if fd.status != dto.DeliveryDead {
+		t.Fatalf("status = %s, want dead", fd.status)
+	}
+	if len(rc.requests) != maxDeliveryAttempts {
+		t.Errorf("requests = %d, want %d", len(rc.requests), maxDeliveryAttempts)
+	}
+	if fd.d.Attempts != maxDeliveryAttempts {
+		t.Errorf("attempts = %d, want %d", fd.d.Attempts, maxDeliveryAttempts)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, maxRetryDelay},
+		{50, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			if got := retryDelay(tt.attempts); got != tt.want {
+				t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS employee_fullname_fts_idx;
+DROP INDEX IF EXISTS employee_fullname_trgm_idx;
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS employee_fullname_trgm_idx ON employees
+    USING gin ((employee_name || ' ' || employee_surname) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS employee_fullname_fts_idx ON employees
+    USING gin (to_tsvector('simple', employee_name || ' ' || employee_surname));
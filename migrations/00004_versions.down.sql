@@ -0,0 +1,2 @@
+ALTER TABLE employees DROP COLUMN IF EXISTS version;
+ALTER TABLE departments DROP COLUMN IF EXISTS version;
@@ -0,0 +1,2 @@
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    event_id bigserial,
+    actor text NOT NULL,
+    action text NOT NULL,
+    entity text NOT NULL,
+    entity_id UUID NOT NULL,
+    before jsonb,
+    after jsonb,
+    diff jsonb,
+    created_at timestamptz NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (event_id)
+);
+CREATE INDEX IF NOT EXISTS audit_events_entity_idx ON audit_events (entity, entity_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
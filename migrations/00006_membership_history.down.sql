@@ -0,0 +1,9 @@
+DELETE FROM employee_department WHERE valid_to IS NOT NULL;
+DROP INDEX IF EXISTS employee_department_department_idx;
+DROP INDEX IF EXISTS employee_department_current_idx;
+ALTER TABLE employee_department DROP CONSTRAINT employee_department_pkey;
+ALTER TABLE employee_department ADD CONSTRAINT employee_department_pkey
+    PRIMARY KEY (employee_id, department_id);
+ALTER TABLE employee_department DROP CONSTRAINT IF EXISTS employee_department_period_check;
+ALTER TABLE employee_department DROP COLUMN IF EXISTS valid_to;
+ALTER TABLE employee_department DROP COLUMN IF EXISTS valid_from;
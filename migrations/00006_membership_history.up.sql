@@ -0,0 +1,12 @@
+ALTER TABLE employee_department ADD COLUMN IF NOT EXISTS valid_from timestamptz NOT NULL DEFAULT now();
+ALTER TABLE employee_department ADD COLUMN IF NOT EXISTS valid_to timestamptz;
+ALTER TABLE employee_department ADD CONSTRAINT employee_department_period_check
+    CHECK (valid_to IS NULL OR valid_to > valid_from);
+
+-- closed memberships stay as history, only one open membership per pair
+ALTER TABLE employee_department DROP CONSTRAINT employee_department_pkey;
+ALTER TABLE employee_department ADD CONSTRAINT employee_department_pkey
+    PRIMARY KEY (employee_id, department_id, valid_from);
+CREATE UNIQUE INDEX IF NOT EXISTS employee_department_current_idx ON employee_department (employee_id, department_id)
+    WHERE valid_to IS NULL;
+CREATE INDEX IF NOT EXISTS employee_department_department_idx ON employee_department (department_id, valid_from, valid_to);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS scheduled_changes (
+    change_id UUID,
+    kind text NOT NULL,
+    payload jsonb NOT NULL,
+    effective_at timestamptz NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    created_by text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    applied_at timestamptz,
+    error text NOT NULL DEFAULT '',
+
+    PRIMARY KEY (change_id)
+);
+CREATE INDEX IF NOT EXISTS scheduled_changes_due_idx ON scheduled_changes (effective_at)
+    WHERE status = 'pending';
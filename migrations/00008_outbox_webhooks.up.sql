@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    event_id bigserial,
+    event_type text NOT NULL,
+    entity_id UUID NOT NULL,
+    data jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    dispatched_at timestamptz,
+
+    PRIMARY KEY (event_id)
+);
+CREATE INDEX IF NOT EXISTS outbox_events_undispatched_idx ON outbox_events (event_id)
+    WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    webhook_id UUID,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL DEFAULT '{}',
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (webhook_id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    webhook_id UUID REFERENCES webhooks (webhook_id) ON DELETE CASCADE,
+    event_id bigint REFERENCES outbox_events (event_id) ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_status integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    delivered_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (webhook_id, event_id)
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at)
+    WHERE status = 'pending';
@@ -0,0 +1,10 @@
+-- explicit parent reference, hierarchy is assembled from it while ltree
+-- path is kept for subtree queries
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES departments (department_id);
+
+UPDATE departments d SET parent_id = p.department_id
+FROM departments p
+WHERE nlevel(d.department_path) > 1
+    AND p.department_path = subpath(d.department_path, 0, nlevel(d.department_path) - 1);
+
+CREATE INDEX IF NOT EXISTS departments_parent_id_idx ON departments (parent_id);
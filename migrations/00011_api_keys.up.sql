@@ -0,0 +1,14 @@
+-- only sha256 of api keys is stored, prefix helps to tell keys apart
+CREATE TABLE IF NOT EXISTS api_keys (
+    api_key_id UUID,
+    name text NOT NULL,
+    key_prefix text NOT NULL,
+    key_hash text NOT NULL,
+    admin boolean NOT NULL DEFAULT false,
+    created_by text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    last_used_at timestamptz,
+
+    PRIMARY KEY (api_key_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_key_hash_idx ON api_keys (key_hash);
@@ -0,0 +1,13 @@
+-- role of subject (jwt sub or key:<name>) on department and its subtree
+CREATE TABLE IF NOT EXISTS role_grants (
+    grant_id UUID,
+    subject text NOT NULL,
+    department_id UUID NOT NULL REFERENCES departments (department_id) ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+    granted_by text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (grant_id),
+    UNIQUE (subject, department_id)
+);
+CREATE INDEX IF NOT EXISTS role_grants_department_id_idx ON role_grants (department_id);
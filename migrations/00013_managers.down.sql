@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS departments_head_id_idx;
+ALTER TABLE departments DROP COLUMN IF EXISTS head_id;
+DROP INDEX IF EXISTS employees_manager_id_idx;
+ALTER TABLE employees DROP CONSTRAINT IF EXISTS employees_manager_not_self;
+ALTER TABLE employees DROP COLUMN IF EXISTS manager_id;
@@ -0,0 +1,9 @@
+-- reporting lines: manager of employee and head of department
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS manager_id UUID
+    REFERENCES employees (employee_id) ON DELETE SET NULL;
+ALTER TABLE employees ADD CONSTRAINT employees_manager_not_self CHECK (manager_id <> employee_id);
+CREATE INDEX IF NOT EXISTS employees_manager_id_idx ON employees (manager_id);
+
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS head_id UUID
+    REFERENCES employees (employee_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS departments_head_id_idx ON departments (head_id);
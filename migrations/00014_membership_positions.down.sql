@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS employee_department_primary_idx;
+ALTER TABLE employee_department DROP CONSTRAINT IF EXISTS employee_department_fte_check;
+ALTER TABLE employee_department DROP COLUMN IF EXISTS is_primary;
+ALTER TABLE employee_department DROP COLUMN IF EXISTS fte;
+ALTER TABLE employee_department DROP COLUMN IF EXISTS position;
@@ -0,0 +1,9 @@
+-- position of employee in department and its share of full time
+ALTER TABLE employee_department ADD COLUMN IF NOT EXISTS position text NOT NULL DEFAULT '';
+ALTER TABLE employee_department ADD COLUMN IF NOT EXISTS fte numeric(3, 2) NOT NULL DEFAULT 1;
+ALTER TABLE employee_department ADD COLUMN IF NOT EXISTS is_primary boolean NOT NULL DEFAULT false;
+ALTER TABLE employee_department ADD CONSTRAINT employee_department_fte_check CHECK (fte > 0 AND fte <= 1);
+
+-- at most one current primary membership per employee
+CREATE UNIQUE INDEX IF NOT EXISTS employee_department_primary_idx ON employee_department (employee_id)
+    WHERE is_primary AND valid_to IS NULL;
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS employee_department_department_check ON employee_department;
+DROP FUNCTION IF EXISTS check_membership_department();
+
+-- history of deleted departments can't be kept with foreign key
+DELETE FROM employee_department ed
+WHERE NOT EXISTS (SELECT 1 FROM departments d WHERE d.department_id = ed.department_id);
+ALTER TABLE employee_department ADD CONSTRAINT employee_department_department_id_fkey
+    FOREIGN KEY (department_id) REFERENCES departments (department_id) ON UPDATE CASCADE;
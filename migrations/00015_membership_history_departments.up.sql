@@ -0,0 +1,24 @@
+-- closed memberships outlive deleted departments as history, so the
+-- department reference is checked for current memberships only. Rows of
+-- department are locked like foreign key does, delete locks the whole
+-- subtree before closing memberships, so either of them waits.
+ALTER TABLE employee_department DROP CONSTRAINT IF EXISTS employee_department_department_id_fkey;
+
+CREATE OR REPLACE FUNCTION check_membership_department() RETURNS trigger AS $$
+BEGIN
+    IF NEW.valid_to IS NULL THEN
+        PERFORM 1 FROM departments WHERE department_id = NEW.department_id FOR KEY SHARE;
+        IF NOT FOUND THEN
+            RAISE foreign_key_violation USING
+                MESSAGE = 'department ' || NEW.department_id || ' does not exist',
+                TABLE = 'employee_department',
+                CONSTRAINT = 'employee_department_department_id_check';
+        END IF;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS employee_department_department_check ON employee_department;
+CREATE TRIGGER employee_department_department_check BEFORE INSERT OR UPDATE OF department_id, valid_to
+    ON employee_department FOR EACH ROW EXECUTE FUNCTION check_membership_department();
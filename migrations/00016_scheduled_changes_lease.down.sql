@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS scheduled_changes_claimed_idx;
+ALTER TABLE scheduled_changes DROP COLUMN IF EXISTS attempts;
+ALTER TABLE scheduled_changes DROP COLUMN IF EXISTS claimed_at;
@@ -0,0 +1,6 @@
+-- claim of change is a lease, change left applying by a crashed worker is
+-- claimed again once the lease expires; attempts fence off stale workers
+ALTER TABLE scheduled_changes ADD COLUMN IF NOT EXISTS claimed_at timestamptz;
+ALTER TABLE scheduled_changes ADD COLUMN IF NOT EXISTS attempts integer NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS scheduled_changes_claimed_idx ON scheduled_changes (claimed_at)
+    WHERE status = 'applying';
@@ -0,0 +1,3 @@
+UPDATE role_grants g SET subject = 'key:' || k.name
+FROM api_keys k
+WHERE g.subject = 'key:' || k.api_key_id;
@@ -0,0 +1,6 @@
+-- api keys act as key:<api_key_id> since names of keys aren't unique,
+-- grants of ambiguous names are left as they are and match no key
+UPDATE role_grants g SET subject = 'key:' || k.api_key_id
+FROM api_keys k
+WHERE g.subject = 'key:' || k.name
+    AND (SELECT count(*) FROM api_keys n WHERE n.name = k.name) = 1;